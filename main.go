@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 )
 
 func main() {
 	plugin.Serve(&plugin.ServeOpts{PluginFunc: mongodb.Plugin})
+	// Serve only returns when the plugin is being stopped, so this is the time to close all the connection pools
+	mongodb.DisconnectAllClients(context.Background())
 }
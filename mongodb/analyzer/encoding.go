@@ -0,0 +1,213 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// primitiveNames are the names that are used for each PrimitiveType when encoding, so the encoding doesn't depend on
+// the order of the PrimitiveType constants
+var primitiveNames = map[PrimitiveType]string{
+	PrimitiveBool:       "bool",
+	PrimitiveDouble:     "double",
+	PrimitiveInt32:      "int32",
+	PrimitiveInt64:      "int64",
+	PrimitiveDecimal:    "decimal",
+	PrimitiveString:     "string",
+	PrimitiveBinary:     "binary",
+	PrimitiveObjectId:   "objectId",
+	PrimitiveRegex:      "regex",
+	PrimitiveJS:         "javascript",
+	PrimitiveScopedCode: "javascriptWithScope",
+	PrimitiveSymbol:     "symbol",
+	PrimitiveDateTime:   "date",
+	PrimitiveTimestamp:  "timestamp",
+	PrimitiveDBPointer:  "dbPointer",
+	PrimitiveMinKey:     "minKey",
+	PrimitiveMaxKey:     "maxKey",
+	PrimitiveUndefined:  "undefined",
+}
+
+// primitivesByName is the inverse of primitiveNames
+var primitivesByName = func() map[string]PrimitiveType {
+	byName := make(map[string]PrimitiveType, len(primitiveNames))
+	for p, name := range primitiveNames {
+		byName[name] = p
+	}
+	return byName
+}()
+
+// PrimitiveTypeByName returns the PrimitiveType with a certain name, the same one that is returned by
+// [PrimitiveType.String] (e.g. "objectId" or "int32")
+func PrimitiveTypeByName(name string) (PrimitiveType, bool) {
+	p, ok := primitivesByName[name]
+	return p, ok
+}
+
+// String returns the name of the primitive type, the same one that is used when encoding it
+func (p PrimitiveType) String() string {
+	if name, ok := primitiveNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("PrimitiveType(%d)", uint(p))
+}
+
+// Kinds of encoded types, see [encodedType]
+const (
+	kindPrimitive = "primitive"
+	kindLiteral   = "literal"
+	kindSlice     = "slice"
+	kindMixed     = "mixed"
+	kindStruct    = "struct"
+)
+
+// encodedType is the JSON representation of a Type. Kind says which of the other fields is set, e.g.
+// {"kind": "primitive", "name": "string"} or {"kind": "slice", "elem": {"kind": "primitive", "name": "int32"}}
+type encodedType struct {
+	Kind   string                  `json:"kind"`
+	Name   string                  `json:"name,omitempty"`   // primitive and literal
+	Elem   *encodedType            `json:"elem,omitempty"`   // slice
+	Types  []*encodedType          `json:"types,omitempty"`  // mixed
+	Fields map[string]*encodedType `json:"fields,omitempty"` // struct
+}
+
+/*
+MarshalType encodes t as JSON, in a format that can be read back by [UnmarshalType]. The encoding is lossless (decoding
+it returns a Type that is [reflect.DeepEqual] to t), with the only exception that nil StructTypes and MixedTypes are
+decoded as empty ones, which behave the same. It's also stable: the same Type always produces the same bytes, since
+the fields of structs are sorted by name, so encoded schemas can be stored in files and diffed
+*/
+func MarshalType(t Type) ([]byte, error) {
+	encoded, err := encodeType(t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalType decodes a Type that was encoded by [MarshalType]
+func UnmarshalType(data []byte) (Type, error) {
+	var encoded *encodedType
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	return decodeType(encoded)
+}
+
+func encodeType(t Type) (*encodedType, error) {
+	switch v := t.(type) {
+	case nil:
+		return nil, nil
+	case PrimitiveType:
+		name, ok := primitiveNames[v]
+		if !ok {
+			return nil, fmt.Errorf("unknown primitive type %d", v)
+		}
+		return &encodedType{Kind: kindPrimitive, Name: name}, nil
+	case LiteralType:
+		return &encodedType{Kind: kindLiteral, Name: v.Literal}, nil
+	case SliceType:
+		elem, err := encodeType(v.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &encodedType{Kind: kindSlice, Elem: elem}, nil
+	case MixedType:
+		encoded := &encodedType{Kind: kindMixed, Types: make([]*encodedType, 0, len(v))}
+		for _, member := range v {
+			m, err := encodeType(member)
+			if err != nil {
+				return nil, err
+			}
+			encoded.Types = append(encoded.Types, m)
+		}
+		return encoded, nil
+	case StructType:
+		encoded := &encodedType{Kind: kindStruct, Fields: make(map[string]*encodedType, len(v))}
+		for k, child := range v {
+			c, err := encodeType(child)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", k, err)
+			}
+			encoded.Fields[k] = c
+		}
+		return encoded, nil
+	default:
+		return nil, fmt.Errorf("unknown type %T", t)
+	}
+}
+
+func decodeType(e *encodedType) (Type, error) {
+	if e == nil {
+		return nil, nil
+	}
+	switch e.Kind {
+	case kindPrimitive:
+		if p, ok := primitivesByName[e.Name]; ok {
+			return p, nil
+		}
+		return nil, fmt.Errorf("unknown primitive type %q", e.Name)
+	case kindLiteral:
+		return LiteralType{Literal: e.Name}, nil
+	case kindSlice:
+		elem, err := decodeType(e.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return SliceType{Type: elem}, nil
+	case kindMixed:
+		mixed := make(MixedType, 0, len(e.Types))
+		for _, member := range e.Types {
+			m, err := decodeType(member)
+			if err != nil {
+				return nil, err
+			}
+			mixed = append(mixed, m)
+		}
+		return mixed, nil
+	case kindStruct:
+		s := make(StructType, len(e.Fields))
+		for k, child := range e.Fields {
+			c, err := decodeType(child)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", k, err)
+			}
+			s[k] = c
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown kind of type %q", e.Kind)
+	}
+}
+
+// The JSON methods let each Type be encoded directly with encoding/json (e.g. as a field of a larger struct), using the
+// same format as [MarshalType]. Decoding into a specific Type fails if the JSON holds a different kind of type
+
+func (s StructType) MarshalJSON() ([]byte, error)    { return MarshalType(s) }
+func (s SliceType) MarshalJSON() ([]byte, error)     { return MarshalType(s) }
+func (m MixedType) MarshalJSON() ([]byte, error)     { return MarshalType(m) }
+func (p PrimitiveType) MarshalJSON() ([]byte, error) { return MarshalType(p) }
+func (l LiteralType) MarshalJSON() ([]byte, error)   { return MarshalType(l) }
+
+func (s *StructType) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, s) }
+func (s *SliceType) UnmarshalJSON(data []byte) error     { return unmarshalInto(data, s) }
+func (m *MixedType) UnmarshalJSON(data []byte) error     { return unmarshalInto(data, m) }
+func (p *PrimitiveType) UnmarshalJSON(data []byte) error { return unmarshalInto(data, p) }
+func (l *LiteralType) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, l) }
+
+// unmarshalInto decodes data with [UnmarshalType], and stores it on target if it's of the same kind
+func unmarshalInto[T Type](data []byte, target *T) error {
+	if string(data) == "null" {
+		return nil // like encoding/json does for other types, null leaves the target untouched
+	}
+	decoded, err := UnmarshalType(data)
+	if err != nil {
+		return err
+	}
+	asT, ok := decoded.(T)
+	if !ok {
+		return fmt.Errorf("can't decode %T into %T", decoded, *target)
+	}
+	*target = asT
+	return nil
+}
@@ -0,0 +1,176 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+func roundTrip(t *testing.T, original Type) Type {
+	t.Helper()
+	encoded, err := MarshalType(original)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding %v: %v", original, err)
+	}
+	decoded, err := UnmarshalType(encoded)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding %s: %v", encoded, err)
+	}
+	return decoded
+}
+
+func TestMarshalTypeRoundTrip(t *testing.T) {
+	cases := map[string]Type{
+		"primitive":           PrimitiveDecimal,
+		"nil literal":         NilType,
+		"other literal":       LiteralType{Literal: "something"},
+		"slice":               SliceType{Type: PrimitiveString},
+		"empty array":         SliceType{Type: MixedType{}},
+		"slice of structs":    SliceType{Type: StructType{"a": PrimitiveInt32}},
+		"slice of slices":     SliceType{Type: SliceType{Type: PrimitiveDouble}},
+		"mixed keeps order":   MixedType{PrimitiveString, NilType, PrimitiveInt32},
+		"mixed with struct":   MixedType{StructType{"a": PrimitiveBool}, SliceType{Type: PrimitiveBool}},
+		"empty struct":        StructType{},
+		"slice without type":  SliceType{},
+		"struct with nil":     StructType{"a": nil},
+		"mixed with nil":      MixedType{nil, PrimitiveString},
+		"nested struct":       StructType{"a": StructType{"b": StructType{"c": PrimitiveTimestamp}}},
+		"names that are JSON": StructType{"kind": PrimitiveString, "$ref": PrimitiveString, "": PrimitiveInt64, "a.b": PrimitiveBool},
+	}
+	for name, original := range cases {
+		t.Run(name, func(t *testing.T) {
+			if decoded := roundTrip(t, original); !reflect.DeepEqual(decoded, original) {
+				t.Errorf("Expected %#v but got %#v", original, decoded)
+			}
+		})
+	}
+}
+
+func TestMarshalTypeRoundTripAllPrimitives(t *testing.T) {
+	for p := PrimitiveBool; p <= PrimitiveUndefined; p++ {
+		if _, ok := primitiveNames[p]; !ok {
+			t.Errorf("PrimitiveType %d has no name, so it can't be encoded", p)
+			continue
+		}
+		if decoded := roundTrip(t, p); decoded != p {
+			t.Errorf("Expected %v but got %v", p, decoded)
+		}
+	}
+}
+
+func TestMarshalTypeRoundTripInferred(t *testing.T) {
+	g := Generator{}
+	docs := []string{
+		`{"_id": {"$oid": "57e193d7a9cc81b4027498b5"}, "n": 1, "tags": ["a"], "items": [{"sku": "x"}], "at": {"$date": "2024-01-01T00:00:00Z"}}`,
+		`{"_id": {"$oid": "57e193d7a9cc81b4027498b6"}, "n": "one", "tags": [], "items": [{"qty": 2}], "maybe": null}`,
+	}
+	for _, doc := range docs {
+		var m bson.M
+		if err := bson.UnmarshalExtJSON([]byte(doc), false, &m); err != nil {
+			t.Fatal(err)
+		}
+		g.Update(m)
+	}
+
+	original := g.GetType()
+	if decoded := roundTrip(t, original); !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Expected %#v but got %#v", original, decoded)
+	}
+}
+
+func TestMarshalTypeNilAndEmptyAreEquivalent(t *testing.T) {
+	if decoded := roundTrip(t, StructType(nil)); !reflect.DeepEqual(decoded, StructType{}) {
+		t.Errorf("Expected a nil StructType to be decoded as an empty one, got %#v", decoded)
+	}
+	if decoded := roundTrip(t, MixedType(nil)); !reflect.DeepEqual(decoded, MixedType{}) {
+		t.Errorf("Expected a nil MixedType to be decoded as an empty one, got %#v", decoded)
+	}
+	if decoded := roundTrip(t, nil); decoded != nil {
+		t.Errorf("Expected nil to be decoded as nil, got %#v", decoded)
+	}
+}
+
+// TestMarshalTypeFormat pins the encoded format, since encoded schemas are stored on disk and may be committed to repos
+func TestMarshalTypeFormat(t *testing.T) {
+	original := StructType{
+		"b": SliceType{Type: PrimitiveObjectId},
+		"a": MixedType{NilType, PrimitiveDateTime},
+	}
+	expected := `{"kind":"struct","fields":{` +
+		`"a":{"kind":"mixed","types":[{"kind":"literal","name":"nil"},{"kind":"primitive","name":"date"}]},` +
+		`"b":{"kind":"slice","elem":{"kind":"primitive","name":"objectId"}}}}`
+
+	for i := 0; i < 10; i++ { // map iteration order is random, so encode a few times
+		encoded, err := MarshalType(original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(encoded) != expected {
+			t.Fatalf("Expected %s but got %s", expected, encoded)
+		}
+	}
+}
+
+func TestUnmarshalTypeErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown primitive": `{"kind": "primitive", "name": "float128"}`,
+		"unknown kind":      `{"kind": "tuple"}`,
+		"missing kind":      `{"name": "string"}`,
+		"nested error":      `{"kind": "struct", "fields": {"a": {"kind": "slice", "elem": {"kind": "nope"}}}}`,
+		"not json":          `{"kind":`,
+	}
+	for name, data := range cases {
+		if decoded, err := UnmarshalType([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error, but got %#v", name, decoded)
+		}
+	}
+	if _, err := MarshalType(PrimitiveType(1000)); err == nil {
+		t.Errorf("Expected an error when encoding an unknown primitive")
+	}
+}
+
+func TestTypesAsJSONFields(t *testing.T) {
+	type snapshot struct {
+		Collection string     `json:"collection"`
+		Schema     StructType `json:"schema"`
+		Tags       SliceType  `json:"tags"`
+		Maybe      MixedType  `json:"maybe"`
+		ID         PrimitiveType
+		Nothing    LiteralType
+	}
+	original := snapshot{
+		Collection: "users",
+		Schema:     StructType{"name": PrimitiveString, "tags": SliceType{Type: PrimitiveString}},
+		Tags:       SliceType{Type: PrimitiveString},
+		Maybe:      MixedType{NilType, PrimitiveInt64},
+		ID:         PrimitiveObjectId,
+		Nothing:    NilType,
+	}
+
+	encoded, err := json.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded snapshot
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Expected %#v but got %#v from %s", original, decoded, encoded)
+	}
+
+	var wrongKind StructType
+	if err := json.Unmarshal([]byte(`{"kind": "primitive", "name": "string"}`), &wrongKind); err == nil {
+		t.Errorf("Expected an error when decoding a primitive into a StructType")
+	}
+}
+
+func TestPrimitiveTypeString(t *testing.T) {
+	if PrimitiveObjectId.String() != "objectId" {
+		t.Errorf("Expected objectId, got %s", PrimitiveObjectId.String())
+	}
+	if PrimitiveType(1000).String() != "PrimitiveType(1000)" {
+		t.Errorf("Expected PrimitiveType(1000), got %s", PrimitiveType(1000).String())
+	}
+}
@@ -15,13 +15,17 @@ import (
 
 // Generator holds state about a set of documents, so they can be incrementally analyzed.
 // Usage: create a new Generator, then repeatedly call Update passing a MongoDB document each time. When done, call
-// GetType once to retrieve the final type inferred from all the passed documents
+// GetType once to retrieve the final type inferred from all the passed documents, and GetStats to know how often each
+// field (and each of its types) appeared
 type Generator struct {
 	// StopOnFields indicates a set of fields that will not be drilled into. Use, for example, for objects with high-cardinality keys, i.e. where the key of the object is _itself_ a variable value, such as an ID
 	StopOnFields  []string
 	positionStack []string
 
 	root StructType
+	// documents and fields hold the statistics that are returned by GetStats
+	documents int
+	fields    map[string]*fieldStatsBuilder
 }
 
 // Update adds a new MongoDB document to the Generator's internal state
@@ -31,6 +35,8 @@ func (gen *Generator) Update(m bson.M) error {
 	}
 
 	gen.root.Merge(gen.TypeOf(m, nil), gen)
+	gen.documents++
+	gen.updateStats(m, nil)
 	return nil
 }
 
@@ -57,6 +63,9 @@ func (l LiteralType) Merge(t Type, gen *Generator) Type {
 	if l.GoType(gen) == t.GoType(gen) {
 		return l
 	}
+	if m, ok := t.(MixedType); ok {
+		return MixedType{l}.Merge(m, gen)
+	}
 	return MixedType{l, t}
 }
 
@@ -68,9 +77,34 @@ func (m MixedType) GoType(gen *Generator) string {
 	return "interface{}"
 }
 
+/*
+Merge adds t to the members of the MixedType. If t is a MixedType itself, each of its members is added, so MixedTypes
+are never nested. Structs are merged into the struct member, if there's one, and arrays into the array member, so e.g.
+Union[nil, []int32] merged with []string is Union[nil, []Union[int32, string]]
+*/
 func (m MixedType) Merge(t Type, gen *Generator) Type {
-	// New type, t, is already one in the list of MixedType, so just return the original list
-	for _, e := range m {
+	if other, ok := t.(MixedType); ok {
+		var merged Type = m
+		for _, member := range other {
+			merged = merged.Merge(member, gen)
+		}
+		return merged
+	}
+
+	for i, e := range m {
+		switch e.(type) {
+		case StructType:
+			if _, ok := t.(StructType); ok {
+				m[i] = e.Merge(t, gen)
+				return m
+			}
+		case SliceType:
+			if _, ok := t.(SliceType); ok {
+				m[i] = e.Merge(t, gen)
+				return m
+			}
+		}
+		// New type, t, is already one in the list of MixedType, so just return the original list
 		if e.GoType(gen) == t.GoType(gen) {
 			return m
 		}
@@ -108,6 +142,47 @@ func (m MixedType) GetNonNilType() Type {
 	}
 }
 
+// numericWidening is the order in which numeric types widen: every type can be converted to the ones after it
+var numericWidening = []PrimitiveType{PrimitiveInt32, PrimitiveInt64, PrimitiveDouble, PrimitiveDecimal}
+
+// stringLike are the types whose values are presented as strings, see [MixedType.Widen]
+var stringLike = []PrimitiveType{PrimitiveString, PrimitiveSymbol, PrimitiveObjectId, PrimitiveBinary, PrimitiveJS, PrimitiveScopedCode}
+
+/*
+Widen returns the narrowest type that all the (non-nil) members of the MixedType can be converted to, following the
+lattice int32 ⊂ int64 ⊂ double ⊂ decimal for numbers, e.g. {int32, double} widens to double. Types whose values are
+presented as strings (strings, symbols, ObjectIDs, binary data and JS code) widen to string. It returns false if the
+members can't be widened to a single type, e.g. for {string, int32} or {string, StructType}
+*/
+func (m MixedType) Widen() (PrimitiveType, bool) {
+	widest, numericCount, stringCount := -1, 0, 0
+	for _, t := range m {
+		if t == NilType {
+			continue
+		}
+		p, ok := t.(PrimitiveType)
+		if !ok {
+			return 0, false
+		}
+		if i := slices.Index(numericWidening, p); i >= 0 {
+			widest = max(widest, i)
+			numericCount++
+		} else if slices.Contains(stringLike, p) {
+			stringCount++
+		} else {
+			return 0, false
+		}
+	}
+	switch {
+	case numericCount > 0 && stringCount == 0:
+		return numericWidening[widest], true
+	case stringCount > 0 && numericCount == 0:
+		return PrimitiveString, true
+	default:
+		return 0, false
+	}
+}
+
 type PrimitiveType uint
 
 const (
@@ -177,6 +252,9 @@ func (p PrimitiveType) Merge(t Type, gen *Generator) Type {
 	if p.GoType(gen) == t.GoType(gen) {
 		return p
 	}
+	if m, ok := t.(MixedType); ok {
+		return MixedType{p}.Merge(m, gen)
+	}
 	return MixedType{p, t}
 }
 
@@ -188,34 +266,31 @@ func (s SliceType) GoType(gen *Generator) string {
 	return fmt.Sprintf("[]%s", s.Type.GoType(gen))
 }
 
+/*
+Merge merges two arrays into an array whose elements have the merged type of the elements of both, e.g. []int32 and
+[]string become []Union[int32, string]. Merging an array with anything else is a union of both
+*/
 func (s SliceType) Merge(t Type, gen *Generator) Type {
-	if s.GoType(gen) == t.GoType(gen) {
-		return s
+	switch o := t.(type) {
+	case SliceType:
+		return SliceType{Type: mergeElementTypes(s.Type, o.Type, gen)}
+	case MixedType:
+		return MixedType{s}.Merge(o, gen)
+	default:
+		return MixedType{s, t}
 	}
+}
 
-	// If the target type is a slice of structs, we merge into the first struct
-	// type in our own slice type.
-	if targetSliceType, ok := t.(SliceType); ok {
-		if targetSliceStructType, ok := targetSliceType.Type.(StructType); ok {
-			// We're a slice of structs.
-			if ownSliceStructType, ok := s.Type.(StructType); ok {
-				s.Type = ownSliceStructType.Merge(targetSliceStructType, gen)
-				return s
-			}
-
-			// We're a slice of mixed types, one of which may or may not be a struct.
-			if sliceMixedType, ok := s.Type.(MixedType); ok {
-				for i, v := range sliceMixedType {
-					if vStructType, ok := v.(StructType); ok {
-						sliceMixedType[i] = vStructType.Merge(targetSliceStructType, gen)
-						return s
-					}
-				}
-				return SliceType{Type: append(sliceMixedType, targetSliceStructType)}
-			}
-		}
+// mergeElementTypes merges the types of the elements of two arrays. Empty arrays have elements of type MixedType{}
+// (i.e. no type was seen), which is left out when merging, so it doesn't remain as a member of the merged type
+func mergeElementTypes(a, b Type, gen *Generator) Type {
+	if m, ok := a.(MixedType); ok && len(m) == 0 {
+		return b
 	}
-	return MixedType{s, t}
+	if m, ok := b.(MixedType); ok && len(m) == 0 {
+		return a
+	}
+	return a.Merge(b, gen)
 }
 
 type StructType map[string]Type
@@ -253,6 +328,9 @@ func (s StructType) Merge(t Type, gen *Generator) Type {
 		}
 		return s
 	}
+	if m, ok := t.(MixedType); ok {
+		return MixedType{s}.Merge(m, gen)
+	}
 	// merge(struct, anything else) = Union[struct, anything else]
 	return MixedType{s, t}
 }
@@ -278,6 +356,29 @@ func (s StructType) GetTypeOfChild(path string) (Type, error) {
 	return finalType, nil
 }
 
+// Copy returns a deep copy of t. This is needed because [StructType.Merge] mutates its receiver in place, so merging
+// into a type that is shared with somebody else must be done on a copy
+func Copy(t Type) Type {
+	switch v := t.(type) {
+	case StructType:
+		s := make(StructType, len(v))
+		for k, child := range v {
+			s[k] = Copy(child)
+		}
+		return s
+	case MixedType:
+		m := make(MixedType, len(v))
+		for i, child := range v {
+			m[i] = Copy(child)
+		}
+		return m
+	case SliceType:
+		return SliceType{Type: Copy(v.Type)}
+	default: // PrimitiveType and LiteralType are plain values
+		return t
+	}
+}
+
 // TypeOf receives an arbitrary value v, taken from a MongoDB database, and returns the Type that
 // the value maps to. The stack parameter is the current path (in the entire document) that this value is located at,
 // for example, if the original doc is {a: {b: 1}}, it'd be TypeOf({b: 1}, {"a"}), or TypeOf(1, {"a", "b"})
@@ -366,23 +467,14 @@ func NewOrderedStructType(d bson.D, gen *Generator, stack []string) Type {
 	return s
 }
 
+// NewArrayType returns the type of an array, whose element type is the merged type of all of its elements (see
+// [SliceType.Merge]). Empty arrays have elements of type MixedType{}, since nothing is known about them
 func NewArrayType(d bson.A, gen *Generator, stack []string) Type {
-	if len(d) == 0 {
-		return SliceType{Type: MixedType{}}
-	}
-	var s Type
+	var elements Type = MixedType{}
 	for _, v := range d {
-		vt := gen.TypeOf(v, stack) // Arrays don't push a new stack context
-		if s == nil {
-			s = SliceType{Type: vt}
-		} else {
-			s.Merge(SliceType{Type: vt}, gen)
-		}
-	}
-	if s == nil {
-		return SliceType{Type: MixedType{}}
+		elements = mergeElementTypes(elements, gen.TypeOf(v, stack), gen) // Arrays don't push a new stack context
 	}
-	return s
+	return SliceType{Type: elements}
 }
 
 func isValidFieldName(n string) bool {
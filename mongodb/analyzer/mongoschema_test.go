@@ -209,3 +209,128 @@ func TestBSONKitchenSink(t *testing.T) {
 		t.Errorf("got %v, want %v", inferredType, expectedType)
 	}
 }
+
+func TestCopyIsDeep(t *testing.T) {
+	original := StructType{"nested": StructType{"a": PrimitiveInt32}, "list": SliceType{MixedType{PrimitiveString}}}
+
+	copied := Copy(original).(StructType)
+	copied["nested"].(StructType)["b"] = PrimitiveString
+	copied["list"].(SliceType).Type.(MixedType)[0] = PrimitiveBool
+
+	expectedType := StructType{"nested": StructType{"a": PrimitiveInt32}, "list": SliceType{MixedType{PrimitiveString}}}
+	if !reflect.DeepEqual(original, expectedType) {
+		t.Errorf("original was modified, got %v, want %v", original, expectedType)
+	}
+}
+
+func TestWiden(t *testing.T) {
+	cases := map[string]struct {
+		mixed    MixedType
+		expected PrimitiveType
+		ok       bool
+	}{
+		"ints":             {mixed: MixedType{PrimitiveInt32, PrimitiveInt64}, expected: PrimitiveInt64, ok: true},
+		"int and double":   {mixed: MixedType{PrimitiveDouble, PrimitiveInt32}, expected: PrimitiveDouble, ok: true},
+		"decimal":          {mixed: MixedType{PrimitiveInt64, PrimitiveDecimal, PrimitiveDouble}, expected: PrimitiveDecimal, ok: true},
+		"with nil":         {mixed: MixedType{NilType, PrimitiveInt32, PrimitiveDouble}, expected: PrimitiveDouble, ok: true},
+		"string-like":      {mixed: MixedType{PrimitiveString, PrimitiveObjectId, PrimitiveSymbol}, expected: PrimitiveString, ok: true},
+		"string and int":   {mixed: MixedType{PrimitiveString, PrimitiveInt32}},
+		"int and bool":     {mixed: MixedType{PrimitiveInt32, PrimitiveBool}},
+		"int and document": {mixed: MixedType{PrimitiveInt32, StructType{"a": PrimitiveInt32}}},
+	}
+	for name, tc := range cases {
+		widened, ok := tc.mixed.Widen()
+		if ok != tc.ok || widened != tc.expected {
+			t.Errorf("%s: expected %v (%v), got %v (%v)", name, tc.expected, tc.ok, widened, ok)
+		}
+	}
+}
+
+func TestHeterogeneousArrays(t *testing.T) {
+	cases := map[string]struct {
+		Val          bson.A
+		ExpectedType Type
+	}{
+		"scalars":             {bson.A{int32(1), "a", int32(2)}, SliceType{MixedType{PrimitiveInt32, PrimitiveString}}},
+		"nulls":               {bson.A{int32(1), nil, int32(2)}, SliceType{MixedType{PrimitiveInt32, NilType}}},
+		"objects and scalars": {bson.A{bson.M{"a": int32(1)}, "x", bson.M{"b": "y"}}, SliceType{MixedType{StructType{"a": PrimitiveInt32, "b": PrimitiveString}, PrimitiveString}}},
+		"nested arrays":       {bson.A{bson.A{int32(1)}, bson.A{"a"}}, SliceType{SliceType{MixedType{PrimitiveInt32, PrimitiveString}}}},
+		"empty nested arrays": {bson.A{bson.A{}, bson.A{"a"}, bson.A{}}, SliceType{SliceType{PrimitiveString}}},
+		"array and scalar":    {bson.A{bson.A{int32(1)}, "a", bson.A{"b"}}, SliceType{MixedType{SliceType{MixedType{PrimitiveInt32, PrimitiveString}}, PrimitiveString}}},
+		"not only the first":  {bson.A{bson.M{"a": int32(1)}, int64(2), int32(3)}, SliceType{MixedType{StructType{"a": PrimitiveInt32}, PrimitiveInt64, PrimitiveInt32}}},
+	}
+
+	for name, tc := range cases {
+		g := Generator{}
+		inferredType := g.TypeOf(tc.Val, nil)
+		if !reflect.DeepEqual(inferredType, tc.ExpectedType) {
+			t.Errorf("%s: got %v, want %v", name, inferredType, tc.ExpectedType)
+		}
+	}
+}
+
+func TestArraysMergeAcrossDocuments(t *testing.T) {
+	cases := map[string]struct {
+		Docs         []bson.M
+		ExpectedType Type
+	}{
+		"different element types": {
+			[]bson.M{{"v": bson.A{int32(1)}}, {"v": bson.A{"a"}}},
+			SliceType{MixedType{PrimitiveInt32, PrimitiveString}},
+		},
+		"empty array first": {
+			[]bson.M{{"v": bson.A{}}, {"v": bson.A{"a"}}},
+			SliceType{PrimitiveString},
+		},
+		"empty array last": {
+			[]bson.M{{"v": bson.A{"a"}}, {"v": bson.A{}}},
+			SliceType{PrimitiveString},
+		},
+		"null": {
+			[]bson.M{{"v": bson.A{int32(1)}}, {"v": nil}, {"v": bson.A{"a"}}},
+			MixedType{SliceType{MixedType{PrimitiveInt32, PrimitiveString}}, NilType},
+		},
+		"scalar": {
+			[]bson.M{{"v": bson.A{int32(1)}}, {"v": "a"}, {"v": bson.A{"b"}}, {"v": int32(2)}},
+			MixedType{SliceType{MixedType{PrimitiveInt32, PrimitiveString}}, PrimitiveString, PrimitiveInt32},
+		},
+		"objects": {
+			[]bson.M{{"v": bson.A{bson.M{"a": int32(1)}}}, {"v": bson.A{bson.M{"b": "x"}, "y"}}},
+			SliceType{MixedType{StructType{"a": PrimitiveInt32, "b": PrimitiveString}, PrimitiveString}},
+		},
+		"scalar first": {
+			[]bson.M{{"v": "a"}, {"v": bson.A{int32(1)}}, {"v": bson.A{nil}}},
+			MixedType{PrimitiveString, SliceType{MixedType{PrimitiveInt32, NilType}}},
+		},
+	}
+
+	for name, tc := range cases {
+		g := Generator{}
+		for _, doc := range tc.Docs {
+			g.Update(doc)
+		}
+		inferredType := g.GetType().(StructType)["v"]
+		if !reflect.DeepEqual(inferredType, tc.ExpectedType) {
+			t.Errorf("%s: got %v, want %v", name, inferredType, tc.ExpectedType)
+		}
+	}
+}
+
+func TestMixedTypesAreNeverNested(t *testing.T) {
+	cases := map[string]struct {
+		Merged       Type
+		ExpectedType Type
+	}{
+		"mixed into mixed":     {MixedType{PrimitiveInt32, NilType}.Merge(MixedType{PrimitiveString, NilType}, nil), MixedType{PrimitiveInt32, NilType, PrimitiveString}},
+		"mixed into primitive": {PrimitiveInt32.Merge(MixedType{PrimitiveString, PrimitiveInt32}, nil), MixedType{PrimitiveInt32, PrimitiveString}},
+		"mixed into nil":       {NilType.Merge(MixedType{PrimitiveString, NilType}, nil), MixedType{NilType, PrimitiveString}},
+		"mixed into struct":    {StructType{"a": PrimitiveInt32}.Merge(MixedType{StructType{"b": PrimitiveBool}, NilType}, nil), MixedType{StructType{"a": PrimitiveInt32, "b": PrimitiveBool}, NilType}},
+		"mixed into array":     {SliceType{PrimitiveInt32}.Merge(MixedType{SliceType{PrimitiveString}, NilType}, nil), MixedType{SliceType{MixedType{PrimitiveInt32, PrimitiveString}}, NilType}},
+	}
+
+	for name, tc := range cases {
+		if !reflect.DeepEqual(tc.Merged, tc.ExpectedType) {
+			t.Errorf("%s: got %v, want %v", name, tc.Merged, tc.ExpectedType)
+		}
+	}
+}
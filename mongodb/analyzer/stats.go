@@ -0,0 +1,191 @@
+package analyzer
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"hash/fnv"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// distinctSketchSize is the number of hashes that are kept for each field to estimate its number of distinct values.
+// Fields with fewer distinct values than this are counted exactly, above it the estimate has an error of about
+// 1/sqrt(distinctSketchSize), i.e. around 6%
+const distinctSketchSize = 256
+
+// Stats describes how often each field appeared on the documents that were passed to [Generator.Update]
+type Stats struct {
+	// Documents is the number of documents that were analyzed
+	Documents int `json:"documents"`
+	// Fields holds the statistics of every field, keyed by their period-separated path (e.g. "name.first"). Fields
+	// inside documents are included, but fields inside arrays aren't
+	Fields map[string]FieldStats `json:"fields"`
+}
+
+// FieldStats describes how often a single field appeared, and with which types
+type FieldStats struct {
+	// Count is the number of documents that contained the field, including those where it was null
+	Count int `json:"count"`
+	// Types counts the documents that had each type on this field, keyed by [TypeName] (e.g. "string" or "null")
+	Types map[string]int `json:"types"`
+	// Distinct is the (approximate) number of distinct values. Values that are documents are not counted
+	Distinct int `json:"distinct"`
+}
+
+// Presence returns the fraction (between 0 and 1) of the documents that contained the field
+func (s Stats) Presence(path string) float64 {
+	if s.Documents == 0 {
+		return 0
+	}
+	return float64(s.Fields[path].Count) / float64(s.Documents)
+}
+
+// fieldStatsBuilder accumulates the statistics of a field while documents are being analyzed
+type fieldStatsBuilder struct {
+	count    int
+	types    map[string]int
+	distinct distinctSketch
+}
+
+// GetStats returns the statistics of all the documents that were provided to Update
+func (gen *Generator) GetStats() Stats {
+	stats := Stats{Documents: gen.documents, Fields: make(map[string]FieldStats, len(gen.fields))}
+	for path, b := range gen.fields {
+		stats.Fields[path] = FieldStats{Count: b.count, Types: maps.Clone(b.types), Distinct: b.distinct.estimate()}
+	}
+	return stats
+}
+
+// updateStats records the fields of a document on the statistics of the Generator. Fields on StopOnFields are counted,
+// but their children aren't
+func (gen *Generator) updateStats(doc any, stack []string) {
+	visit := func(k string, v any) {
+		path := strings.Join(append(stack, k), ".")
+		if gen.fields == nil {
+			gen.fields = map[string]*fieldStatsBuilder{}
+		}
+		b, ok := gen.fields[path]
+		if !ok {
+			b = &fieldStatsBuilder{types: map[string]int{}}
+			gen.fields[path] = b
+		}
+		b.count++
+		b.types[valueTypeName(v, gen)]++
+
+		switch v.(type) {
+		case primitive.M, primitive.D:
+			if !slices.Contains(gen.StopOnFields, path) {
+				gen.updateStats(v, append(stack, k))
+			}
+		default:
+			b.distinct.add(v)
+		}
+	}
+
+	switch d := doc.(type) {
+	case primitive.M:
+		for k, v := range d {
+			visit(k, v)
+		}
+	case primitive.D:
+		for _, e := range d {
+			visit(e.Key, e.Value)
+		}
+	}
+}
+
+// valueTypeName is the [TypeName] of the type of v. Documents and arrays aren't analyzed, since only their names are needed
+func valueTypeName(v any, gen *Generator) string {
+	switch v.(type) {
+	case primitive.M, primitive.D:
+		return "object"
+	case primitive.A:
+		return "array"
+	default:
+		return TypeName(gen.TypeOf(v, nil))
+	}
+}
+
+/*
+TypeName returns a short name for a type, as shown to users: the name of primitives (see [PrimitiveType.String]),
+"object" for documents, "array" for arrays, and "null". Union types are the names of their members separated by "|",
+except that Union[T, nil] is just the name of T
+*/
+func TypeName(t Type) string {
+	switch v := t.(type) {
+	case PrimitiveType:
+		return v.String()
+	case StructType:
+		return "object"
+	case SliceType:
+		return "array"
+	case MixedType:
+		if v.IsNilAndOther() {
+			return TypeName(v.GetNonNilType())
+		}
+		names := make([]string, len(v))
+		for i, child := range v {
+			names[i] = TypeName(child)
+		}
+		return strings.Join(names, "|")
+	case LiteralType:
+		if v == NilType {
+			return "null"
+		}
+		return v.Literal
+	default:
+		return "unknown"
+	}
+}
+
+/*
+distinctSketch estimates the number of distinct values of a field in bounded memory, by keeping only the smallest
+[distinctSketchSize] hashes of the values that were seen (a "k minimum values" sketch). While fewer than that many
+distinct hashes were seen, the count is exact (barring hash collisions)
+*/
+type distinctSketch struct {
+	hashes []uint64 // sorted, without duplicates
+}
+
+func (s *distinctSketch) add(v any) {
+	h := hashValue(v)
+	i, found := slices.BinarySearch(s.hashes, h)
+	if found {
+		return
+	}
+	if len(s.hashes) == distinctSketchSize {
+		if i == len(s.hashes) {
+			return // larger than all the kept hashes
+		}
+		s.hashes = s.hashes[:len(s.hashes)-1]
+	}
+	s.hashes = slices.Insert(s.hashes, i, h)
+}
+
+func (s *distinctSketch) estimate() int {
+	if len(s.hashes) < distinctSketchSize {
+		return len(s.hashes)
+	}
+	// The k-th smallest of n uniformly distributed hashes is expected to be at about k/n of the hash space
+	fraction := float64(s.hashes[len(s.hashes)-1]) / math.MaxUint64
+	return int(math.Round(float64(distinctSketchSize-1) / fraction))
+}
+
+// hashValue hashes a BSON value, so that equal values (of the same type) have the same hash
+func hashValue(v any) uint64 {
+	h := fnv.New64a()
+	// The type is included so 1 and "1" are different values. fmt prints the keys of maps sorted, so documents inside
+	// arrays are printed in the same way every time
+	fmt.Fprintf(h, "%T:%v", v, v)
+	// FNV doesn't spread short inputs evenly over the hash space, which the sketch relies on, so finish with the
+	// mixing function of SplitMix64
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
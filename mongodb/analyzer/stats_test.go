@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	g := Generator{StopOnFields: []string{"reactions"}}
+	docs := []bson.M{
+		{"_id": int32(1), "email": "a@example.com", "name": bson.M{"first": "A"}, "tags": bson.A{"x"}, "reactions": bson.M{"u1": "+1"}},
+		{"_id": int32(2), "email": "b@example.com", "name": bson.M{"first": "A", "last": "B"}, "tags": bson.A{"x"}},
+		{"_id": int32(3), "email": nil, "name": "A B"},
+		{"_id": int32(4), "email": int32(5), "name": bson.D{{Key: "first", Value: "C"}}},
+	}
+	for _, doc := range docs {
+		g.Update(doc)
+	}
+
+	expected := Stats{Documents: 4, Fields: map[string]FieldStats{
+		"_id":        {Count: 4, Types: map[string]int{"int32": 4}, Distinct: 4},
+		"email":      {Count: 4, Types: map[string]int{"string": 2, "null": 1, "int32": 1}, Distinct: 4},
+		"name":       {Count: 4, Types: map[string]int{"object": 3, "string": 1}, Distinct: 1},
+		"name.first": {Count: 3, Types: map[string]int{"string": 3}, Distinct: 2},
+		"name.last":  {Count: 1, Types: map[string]int{"string": 1}, Distinct: 1},
+		"tags":       {Count: 2, Types: map[string]int{"array": 2}, Distinct: 1},
+		"reactions":  {Count: 1, Types: map[string]int{"object": 1}, Distinct: 0},
+	}}
+	stats := g.GetStats()
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected stats to be\n%+v\nbut they were\n%+v", expected, stats)
+	}
+	if presence := stats.Presence("name.first"); presence != 0.75 {
+		t.Errorf("Expected name.first to be present on 75%% of the documents, got %v", presence)
+	}
+	if presence := stats.Presence("missing"); presence != 0 {
+		t.Errorf("Expected a missing field to have presence 0, got %v", presence)
+	}
+}
+
+func TestStatsWithoutDocuments(t *testing.T) {
+	g := Generator{}
+	stats := g.GetStats()
+	if stats.Documents != 0 || len(stats.Fields) != 0 || stats.Presence("a") != 0 {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+}
+
+func TestDistinctSketch(t *testing.T) {
+	for _, n := range []int{0, 1, 100, distinctSketchSize - 1, 10_000, 100_000} {
+		var s distinctSketch
+		for i := 0; i < n; i++ {
+			s.add(int64(i))
+			s.add(int64(i)) // duplicates must not be counted
+		}
+		estimate := s.estimate()
+		if n < distinctSketchSize {
+			if estimate != n {
+				t.Errorf("Expected an exact count of %d, got %d", n, estimate)
+			}
+			continue
+		}
+		if relativeError := math.Abs(float64(estimate-n)) / float64(n); relativeError > 0.2 {
+			t.Errorf("Expected an estimate close to %d, got %d", n, estimate)
+		}
+	}
+}
+
+func TestDistinctSketchTypes(t *testing.T) {
+	var s distinctSketch
+	for _, v := range []any{int32(1), "1", int64(1), primitive.NewObjectID(), bson.A{bson.M{"a": 1, "b": 2}}, bson.A{bson.M{"b": 2, "a": 1}}} {
+		s.add(v)
+	}
+	if estimate := s.estimate(); estimate != 5 {
+		t.Errorf("Expected 5 distinct values (values of different types are different, equal documents are equal), got %d", estimate)
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	testCases := map[string]Type{
+		"objectId":     PrimitiveObjectId,
+		"object":       StructType{"a": PrimitiveString},
+		"array":        SliceType{Type: PrimitiveString},
+		"null":         NilType,
+		"string":       MixedType{NilType, PrimitiveString},
+		"int32|string": MixedType{PrimitiveInt32, PrimitiveString},
+	}
+	for expected, typ := range testCases {
+		if actual := TypeName(typ); actual != expected {
+			t.Errorf("Expected %#v to be named %s, got %s", typ, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"slices"
+	"strings"
+)
+
+// Columns that child tables have on top of the fields of the elements of their array
+const (
+	// childParentIDColumn holds the _id of the document that contains the element
+	childParentIDColumn = "_parent_id"
+	// childIndexColumn holds the position of the element on its array, starting from 0
+	childIndexColumn = "_index"
+)
+
+// childTableName returns the name of the child table for the array at path, e.g. orders__line_items for the line_items
+// array of the orders table. Periods in the path are replaced by underscores
+func childTableName(parentTable, path string) string {
+	return parentTable + "__" + strings.ReplaceAll(path, ".", "_")
+}
+
+/*
+unwindPipeline builds the pipeline that produces the rows of a child table from the documents of its collection: one row
+per element of the array at path, which must be an array of documents. Each row is the element itself, plus the _id of
+its document (as [childParentIDColumn]) and its position on the array (as [childIndexColumn]). Those two overwrite any
+fields of the element with the same names.
+
+Elements that aren't documents are skipped, and so are documents where the field isn't an array (otherwise $unwind
+would treat, e.g., a single document as an array with just that document). The array can be nested inside documents
+(e.g. "shipping.packages"), but not inside other arrays
+*/
+func unwindPipeline(path string) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{path: bson.M{"$type": "array"}}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$" + path, "includeArrayIndex": childIndexColumn}}},
+		{{Key: "$match", Value: bson.M{path: bson.M{"$type": "object"}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": bson.M{"$mergeObjects": bson.A{
+			"$" + path,
+			bson.M{childParentIDColumn: "$_id", childIndexColumn: "$" + childIndexColumn},
+		}}}}},
+	}
+}
+
+/*
+splitParentFilter moves the conditions on [childParentIDColumn] out of the filter of a child table, into a filter on the
+_id of the parent documents. That filter is applied before unwinding the arrays, so it can use the index on _id, instead
+of unwinding every document of the collection and then discarding most of the elements
+*/
+func splitParentFilter(filter bson.D) (parentFilter, childFilter bson.D) {
+	for _, e := range filter {
+		if e.Key == childParentIDColumn {
+			parentFilter = append(parentFilter, bson.E{Key: "_id", Value: e.Value})
+		} else {
+			childFilter = append(childFilter, e)
+		}
+	}
+	return parentFilter, childFilter
+}
+
+/*
+childElementType returns the schema of the rows of the child table for the array at path of a table that was already
+built. Its fields are those of the merged type of the documents of the array, which the parent's [analyzer.SliceType]
+already holds, so the elements don't need to be sampled again. [childParentIDColumn] has the type of the _id of the
+parent, and [childIndexColumn] is always an Int64. Fields on ignoreFields (relative to the elements) are reported as
+documents without fields, as the Generator does when sampling. The second return value is false if the field isn't an
+array that has documents
+*/
+func childElementType(connectionName, tableName, path string, ignoreFields []string) (analyzer.StructType, bool) {
+	schema, ok := lookupTableSchema(connectionName, tableName)
+	if !ok {
+		return nil, false
+	}
+	t, err := schema.TypeMap.GetTypeOfChild(path)
+	if err != nil {
+		return nil, false
+	}
+	if mixed, ok := t.(analyzer.MixedType); ok {
+		t = mixed.GetNonNilType()
+	}
+	slice, ok := t.(analyzer.SliceType)
+	if !ok {
+		return nil, false
+	}
+	element := slice.Type
+	if mixed, ok := element.(analyzer.MixedType); ok {
+		// The documents of an array are merged into a single StructType, so there's at most one of them
+		if i := slices.IndexFunc(mixed, isStruct); i >= 0 {
+			element = mixed[i]
+		}
+	}
+	elementStruct, ok := element.(analyzer.StructType)
+	if !ok {
+		return nil, false
+	}
+
+	typeMap := withoutIgnoredFields(elementStruct, "", ignoreFields)
+	if parentID, ok := schema.TypeMap["_id"]; ok {
+		typeMap[childParentIDColumn] = parentID
+	}
+	typeMap[childIndexColumn] = analyzer.PrimitiveInt64 // $unwind always outputs the index as a long
+	return typeMap, true
+}
+
+// withoutIgnoredFields returns a copy of s where the fields on ignoreFields (whose paths are relative to prefix) are
+// replaced by empty StructTypes. s itself isn't modified, since it belongs to the schema of another table
+func withoutIgnoredFields(s analyzer.StructType, prefix string, ignoreFields []string) analyzer.StructType {
+	result := make(analyzer.StructType, len(s))
+	for k, t := range s {
+		path := joinPath(prefix, k)
+		if slices.Contains(ignoreFields, path) {
+			result[k] = analyzer.StructType{}
+		} else if child, ok := t.(analyzer.StructType); ok {
+			result[k] = withoutIgnoredFields(child, path, ignoreFields)
+		} else {
+			result[k] = t
+		}
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+func TestChildTableName(t *testing.T) {
+	if name := childTableName("orders", "line_items"); name != "orders__line_items" {
+		t.Errorf("Expected orders__line_items, got %s", name)
+	}
+	if name := childTableName("shop__orders", "shipping.packages"); name != "shop__orders__shipping_packages" {
+		t.Errorf("Expected shop__orders__shipping_packages, got %s", name)
+	}
+}
+
+func TestUnwindPipeline(t *testing.T) {
+	pipeline := unwindPipeline("shipping.packages")
+	unwind := pipeline[1][0]
+	expected := bson.E{Key: "$unwind", Value: bson.M{"path": "$shipping.packages", "includeArrayIndex": "_index"}}
+	if !reflect.DeepEqual(unwind, expected) {
+		t.Errorf("Expected the array to be unwound with %v, got %v", expected, unwind)
+	}
+	if _, err := bson.Marshal(bson.D{{Key: "pipeline", Value: pipeline}}); err != nil {
+		t.Errorf("Pipeline can't be marshalled: %v", err)
+	}
+}
+
+func TestSplitParentFilter(t *testing.T) {
+	filter := bson.D{
+		{"_parent_id", bson.M{"$eq": "a"}},
+		{"sku", bson.M{"$eq": "b"}},
+		{"_index", bson.M{"$lt": int64(3)}},
+	}
+
+	parentFilter, childFilter := splitParentFilter(filter)
+	expectedParent := bson.D{{"_id", bson.M{"$eq": "a"}}}
+	expectedChild := bson.D{{"sku", bson.M{"$eq": "b"}}, {"_index", bson.M{"$lt": int64(3)}}}
+	if !reflect.DeepEqual(parentFilter, expectedParent) {
+		t.Errorf("Expected parent filter to be %v but it was %v", expectedParent, parentFilter)
+	}
+	if !reflect.DeepEqual(childFilter, expectedChild) {
+		t.Errorf("Expected child filter to be %v but it was %v", expectedChild, childFilter)
+	}
+}
+
+func TestChildElementType(t *testing.T) {
+	registerTableSchema("test_child_tables", "orders", tableSchema{TypeMap: analyzer.StructType{
+		"_id": analyzer.PrimitiveObjectId,
+		"line_items": analyzer.SliceType{Type: analyzer.StructType{
+			"sku":  analyzer.PrimitiveString,
+			"meta": analyzer.StructType{"source": analyzer.PrimitiveString, "raw": analyzer.StructType{"a": analyzer.PrimitiveInt32}},
+		}},
+		"notes":    analyzer.MixedType{analyzer.NilType, analyzer.SliceType{Type: analyzer.MixedType{analyzer.PrimitiveString, analyzer.StructType{"text": analyzer.PrimitiveString}}}},
+		"tags":     analyzer.SliceType{Type: analyzer.PrimitiveString},
+		"shipping": analyzer.StructType{"packages": analyzer.SliceType{Type: analyzer.StructType{"weight": analyzer.PrimitiveDouble}}},
+		"customer": analyzer.StructType{"name": analyzer.PrimitiveString},
+	}})
+	defer forgetTableSchemas("test_child_tables")
+
+	cases := []struct {
+		path         string
+		ignoreFields []string
+		expected     analyzer.StructType
+		ok           bool
+	}{
+		{"line_items", nil, analyzer.StructType{
+			"sku":               analyzer.PrimitiveString,
+			"meta":              analyzer.StructType{"source": analyzer.PrimitiveString, "raw": analyzer.StructType{"a": analyzer.PrimitiveInt32}},
+			childParentIDColumn: analyzer.PrimitiveObjectId,
+			childIndexColumn:    analyzer.PrimitiveInt64,
+		}, true},
+		{"line_items", []string{"meta.raw"}, analyzer.StructType{
+			"sku":               analyzer.PrimitiveString,
+			"meta":              analyzer.StructType{"source": analyzer.PrimitiveString, "raw": analyzer.StructType{}},
+			childParentIDColumn: analyzer.PrimitiveObjectId,
+			childIndexColumn:    analyzer.PrimitiveInt64,
+		}, true},
+		{"notes", nil, analyzer.StructType{
+			"text":              analyzer.PrimitiveString,
+			childParentIDColumn: analyzer.PrimitiveObjectId,
+			childIndexColumn:    analyzer.PrimitiveInt64,
+		}, true},
+		{"shipping.packages", nil, analyzer.StructType{
+			"weight":            analyzer.PrimitiveDouble,
+			childParentIDColumn: analyzer.PrimitiveObjectId,
+			childIndexColumn:    analyzer.PrimitiveInt64,
+		}, true},
+		{"tags", nil, nil, false},
+		{"customer", nil, nil, false},
+		{"missing", nil, nil, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			actual, ok := childElementType("test_child_tables", "orders", tc.path, tc.ignoreFields)
+			if ok != tc.ok {
+				t.Fatalf("Expected ok to be %v, got %v", tc.ok, ok)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+
+	// The schema of the parent must be left as is
+	schema, _ := lookupTableSchema("test_child_tables", "orders")
+	meta := schema.TypeMap["line_items"].(analyzer.SliceType).Type.(analyzer.StructType)["meta"].(analyzer.StructType)
+	if len(meta["raw"].(analyzer.StructType)) != 1 {
+		t.Errorf("Expected the parent's schema to keep its ignored fields, got %v", meta)
+	}
+	if _, ok := childElementType("test_child_tables", "customers", "line_items", nil); ok {
+		t.Errorf("Expected tables that weren't built to have no arrays")
+	}
+}
@@ -0,0 +1,122 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/turbot/steampipe-plugin-sdk/v5/connection"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"sync"
+)
+
+// clients holds every [mongo.Client] that has been opened by the plugin, keyed by the same key that is used on the
+// connection cache. The connection cache may evict entries at any time (it has a TTL and a max cost), so this map is
+// the source of truth that lets us find the clients again to disconnect them
+var (
+	clients     = map[string]*mongo.Client{}
+	clientsLock sync.Mutex
+)
+
+// clientCacheKey builds the key under which the client for a certain connection string is stored. The connection
+// string is hashed, since it usually has credentials embedded and cache keys may end up in logs
+func clientCacheKey(connectionName, connectionString string) string {
+	hash := sha256.Sum256([]byte(connectionString))
+	return fmt.Sprintf("mongodb.client.%s.%s", connectionName, hex.EncodeToString(hash[:]))
+}
+
+/*
+getClient returns a [mongo.Client] for the provided connection string, reusing a previously-opened one if possible.
+Clients are stored on the connection cache (so they're automatically scoped to a single Steampipe connection), and
+they're only created the first time that they're requested. Each [mongo.Client] is itself a connection pool that is
+safe for concurrent use, so a single client can serve both schema discovery and all the list hydrates
+*/
+func getClient(ctx context.Context, cache *connection.ConnectionCache, connectionName, connectionString string) (*mongo.Client, error) {
+	key := clientCacheKey(connectionName, connectionString)
+	if cached, ok := cache.Get(ctx, key); ok {
+		return cached.(*mongo.Client), nil
+	}
+
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	// The client may have been evicted from the connection cache but still be alive, in that case just put it back
+	client, ok := clients[key]
+	if !ok {
+		var err error
+		client, err = mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+		if err != nil {
+			return nil, err
+		}
+		plugin.Logger(ctx).Debug("mongodb.getClient", "msg", "opened new client", "connection", connectionName)
+		clients[key] = client
+	}
+
+	if err := cache.Set(ctx, key, client); err != nil {
+		// Not fatal, the next call will find the client on the clients map anyway
+		plugin.Logger(ctx).Warn("mongodb.getClient", "msg", "couldn't cache client", "connection", connectionName, "err", err)
+	}
+	return client, nil
+}
+
+// getClientForQuery is a shortcut around [getClient] for use in hydrate functions
+func getClientForQuery(ctx context.Context, d *plugin.QueryData) (*mongo.Client, error) {
+	connectionString, err := GetConfig(d.Connection).GetConnectionString()
+	if err != nil {
+		return nil, err
+	}
+	return getClient(ctx, d.ConnectionCache, d.Connection.Name, connectionString)
+}
+
+// disconnectClient closes the client that belongs to a certain connection, if one has been opened before
+func disconnectClient(ctx context.Context, connectionName, connectionString string) error {
+	key := clientCacheKey(connectionName, connectionString)
+
+	clientsLock.Lock()
+	client, ok := clients[key]
+	delete(clients, key)
+	clientsLock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return client.Disconnect(ctx)
+}
+
+// DisconnectAllClients closes every client that the plugin has ever opened. It should be called once, when the plugin
+// is shutting down
+func DisconnectAllClients(ctx context.Context) {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	for key, client := range clients {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Printf("[WARN] mongodb.DisconnectAllClients: failed to disconnect client %s: %s", key, err.Error())
+		}
+		delete(clients, key)
+	}
+}
+
+/*
+connectionConfigChanged is called by Steampipe whenever the config of a connection changes. The client that was
+opened with the old config is disconnected (the connection string may have changed, or it may point to another
+cluster altogether), and then the same cleanup that the SDK does by default is performed (i.e. clearing both the
+connection cache and the query cache), so the next query opens a new client with the new config
+*/
+func connectionConfigChanged(ctx context.Context, p *plugin.Plugin, old, new *plugin.Connection) error {
+	if old != nil {
+		if connectionString, err := GetConfig(old).GetConnectionString(); err == nil {
+			if err := disconnectClient(ctx, old.Name, connectionString); err != nil {
+				plugin.Logger(ctx).Warn("mongodb.connectionConfigChanged", "msg", "couldn't disconnect old client", "connection", old.Name, "err", err)
+			}
+		}
+	}
+
+	if err := p.ClearConnectionCache(ctx, new.Name); err != nil {
+		return err
+	}
+	return p.ClearQueryCache(ctx, new.Name)
+}
@@ -3,25 +3,108 @@ package mongodb
 import (
 	"fmt"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
-	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/schema"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
+// MongoDBConfig is parsed with hcl tags (rather than the legacy cty tags and schema map), since the cty schema can only
+// describe primitives and lists of them, which isn't enough for args that hold objects
 type MongoDBConfig struct {
-	ConnectionString    *string  `cty:"connection_string"`
-	Database            string   `cty:"database"`
-	CollectionsToExpose []string `cty:"collections_to_expose"`
-	SampleSize          *int     `cty:"sample_size"`
-	FieldsToIgnore      []string `cty:"fields_to_ignore"`
+	ConnectionString    *string             `hcl:"connection_string,optional"`
+	Database            string              `hcl:"database,optional"`
+	Databases           []string            `hcl:"databases,optional"`
+	TableNameFormat     *string             `hcl:"table_name_format,optional"`
+	CollectionsToExpose []string            `hcl:"collections_to_expose,optional"`
+	SampleSize          *int                `hcl:"sample_size,optional"`
+	FieldsToIgnore      []string            `hcl:"fields_to_ignore,optional"`
+	SchemaGroup         *string             `hcl:"schema_group,optional"`
+	Views               []map[string]string `hcl:"views,optional"`
+	// IncludeSystemCollections exposes collections whose names start with "system.", which are skipped by default
+	IncludeSystemCollections bool `hcl:"include_system_collections,optional"`
+	// RequireIndexedFilter rejects queries on collections that don't filter on at least one indexed field
+	RequireIndexedFilter bool `hcl:"require_indexed_filter,optional"`
+	// SchemaCacheTTL is how long an inferred schema is reused, as a Go duration (e.g. "24h"). Unset disables the cache
+	SchemaCacheTTL *string `hcl:"schema_cache_ttl,optional"`
+	SchemaCacheDir *string `hcl:"schema_cache_dir,optional"`
+	// MixedTypeStrategy decides the type of the columns of fields that have several types, one of the mixedType* values
+	MixedTypeStrategy *string `hcl:"mixed_type_strategy,optional"`
+	// ChildTables are arrays of documents that are exposed as tables of their own, as "collection:path.to.array"
+	ChildTables []string `hcl:"child_tables,optional"`
+	// CollectionSchemas declare the columns of some collections, instead of (or on top of) inferring them
+	CollectionSchemas []CollectionSchemaConfig `hcl:"collection_schema,block"`
 }
 
-var ConfigSchema = map[string]*schema.Attribute{
-	"connection_string":     {Type: schema.TypeString},
-	"database":              {Type: schema.TypeString, Required: true},
-	"collections_to_expose": {Type: schema.TypeList, Elem: &schema.Attribute{Type: schema.TypeString}},
-	"sample_size":           {Type: schema.TypeInt},
-	"fields_to_ignore":      {Type: schema.TypeList, Elem: &schema.Attribute{Type: schema.TypeString}},
+/*
+CollectionSchemaConfig declares some (or all) of the columns of a collection, or of a view that is declared on the config.
+Collection is the name of the collection (or view), and Database is only needed if several databases are exposed.
+Precedence says what happens with the columns that are also inferred by sampling: one of the schemaPrecedence* values
+*/
+type CollectionSchemaConfig struct {
+	Collection string                   `hcl:"collection,label"`
+	Database   *string                  `hcl:"database,optional"`
+	Precedence *string                  `hcl:"precedence,optional"`
+	Columns    []CollectionColumnConfig `hcl:"column,block"`
+}
+
+// CollectionColumnConfig declares a single column. Path is the path to the field (e.g. "customer.name"), which defaults
+// to the name of the column. Type is the BSON type of the field, see [parseDeclaredType]
+type CollectionColumnConfig struct {
+	Name string  `hcl:"name,label"`
+	Path *string `hcl:"path,optional"`
+	Type string  `hcl:"type"`
+}
+
+// Precedence of the declared columns over the inferred ones, see [CollectionSchemaConfig]
+const (
+	// schemaPrecedenceDeclared uses the declared type of each declared column, and the inferred ones for the rest
+	schemaPrecedenceDeclared = "declared"
+	// schemaPrecedenceInferred uses the inferred type of each column, the declared columns only add those that weren't
+	// found while sampling
+	schemaPrecedenceInferred = "inferred"
+	// schemaPrecedenceOnly exposes only the declared columns, and the collection isn't sampled at all
+	schemaPrecedenceOnly = "only"
+)
+
+// GetCollectionSchema returns the declared schema of a collection, or nil if it has none
+func (c MongoDBConfig) GetCollectionSchema(database, collection string) *CollectionSchemaConfig {
+	for i, schema := range c.CollectionSchemas {
+		if schema.Collection == collection && (schema.Database == nil || *schema.Database == database) {
+			return &c.CollectionSchemas[i]
+		}
+	}
+	return nil
+}
+
+// GetPrecedence returns the precedence of the declared columns, which defaults to schemaPrecedenceDeclared
+func (s CollectionSchemaConfig) GetPrecedence() (string, error) {
+	if s.Precedence == nil || *s.Precedence == "" {
+		return schemaPrecedenceDeclared, nil
+	}
+	switch *s.Precedence {
+	case schemaPrecedenceDeclared, schemaPrecedenceInferred, schemaPrecedenceOnly:
+		return *s.Precedence, nil
+	default:
+		return "", fmt.Errorf("invalid precedence %q on collection_schema %s, must be one of %s, %s or %s", *s.Precedence, s.Collection, schemaPrecedenceDeclared, schemaPrecedenceInferred, schemaPrecedenceOnly)
+	}
+}
+
+// GetPath returns the path of the field that backs the column
+func (c CollectionColumnConfig) GetPath() string {
+	if c.Path != nil && *c.Path != "" {
+		return *c.Path
+	}
+	return c.Name
+}
+
+// ViewConfig is a named aggregation pipeline, declared on the views config arg, that will be exposed as its own table
+type ViewConfig struct {
+	Name       string
+	Database   string
+	Collection string
+	Pipeline   string
 }
 
 func ConfigInstance() interface{} {
@@ -39,8 +122,8 @@ func GetConfig(connection *plugin.Connection) MongoDBConfig {
 
 func (c MongoDBConfig) String() string {
 	return fmt.Sprintf(
-		"MongoDBConfig{database=%s}",
-		c.Database) // can't print connection_string, since it has credentials embedded
+		"MongoDBConfig{database=%s, databases=%v}",
+		c.Database, c.Databases) // can't print connection_string, since it has credentials embedded
 }
 
 func (c MongoDBConfig) GetConnectionString() (string, error) {
@@ -55,6 +138,69 @@ func (c MongoDBConfig) GetConnectionString() (string, error) {
 	return "", fmt.Errorf("please provide either the connection_string param or the DATABASE_URL envvar")
 }
 
+/*
+GetDatabases returns the list of database globs that should be exposed. [MongoDBConfig.Database] is kept for backwards
+compatibility, and it's treated as a single-item list. If both are set, the databases on both are exposed
+*/
+func (c MongoDBConfig) GetDatabases() ([]string, error) {
+	databases := slices.Clone(c.Databases)
+	if c.Database != "" && !slices.Contains(databases, c.Database) {
+		databases = append([]string{c.Database}, databases...)
+	}
+	if len(databases) == 0 {
+		return nil, fmt.Errorf("please provide either the database or the databases param")
+	}
+	return databases, nil
+}
+
+/*
+GetTableNameFormat returns the template that is used to name the tables, where {database} and {collection} will be
+replaced by the actual names. If not set, it defaults to just "{collection}" when a single database is configured via
+[MongoDBConfig.Database] (which is the historical behavior), and to "{database}__{collection}" when
+[MongoDBConfig.Databases] is used, since in that case collections with the same name may exist on several databases
+*/
+func (c MongoDBConfig) GetTableNameFormat() string {
+	if c.TableNameFormat != nil && *c.TableNameFormat != "" {
+		return *c.TableNameFormat
+	}
+	if len(c.Databases) == 0 {
+		return "{collection}"
+	}
+	return "{database}__{collection}"
+}
+
+// GetTableName applies [MongoDBConfig.GetTableNameFormat] to a certain database and collection
+func (c MongoDBConfig) GetTableName(database, collection string) string {
+	return strings.NewReplacer("{database}", database, "{collection}", collection).Replace(c.GetTableNameFormat())
+}
+
+/*
+GetViews parses and validates the views that have been declared on [MongoDBConfig.Views]. Each view must have a name, a
+collection and a pipeline. The database is optional if the connection only exposes a single database
+*/
+func (c MongoDBConfig) GetViews() ([]ViewConfig, error) {
+	views := make([]ViewConfig, 0, len(c.Views))
+	for i, raw := range c.Views {
+		view := ViewConfig{Name: raw["name"], Database: raw["database"], Collection: raw["collection"], Pipeline: raw["pipeline"]}
+		for key := range raw {
+			if !slices.Contains([]string{"name", "database", "collection", "pipeline"}, key) {
+				return nil, fmt.Errorf("views[%d]: unknown key %s", i, key)
+			}
+		}
+		if view.Name == "" || view.Collection == "" || view.Pipeline == "" {
+			return nil, fmt.Errorf("views[%d]: name, collection and pipeline are required", i)
+		}
+		if view.Database == "" {
+			if c.Database == "" || len(c.Databases) > 0 {
+				return nil, fmt.Errorf("views[%d] (%s): database is required when the connection exposes several databases", i, view.Name)
+			}
+			view.Database = c.Database
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
 /*
 GetCollectionsToExpose returns the slice of collection blobs that was configured in the .spc file, if set, and ["*"] otherwise (which will expose every collection)
 */
@@ -65,6 +211,59 @@ func (c MongoDBConfig) GetCollectionsToExpose() []string {
 	return []string{"*"}
 }
 
+// GetSchemaCacheTTL returns how long inferred schemas should be cached for, or 0 if they shouldn't be cached at all
+func (c MongoDBConfig) GetSchemaCacheTTL() (time.Duration, error) {
+	if c.SchemaCacheTTL == nil || *c.SchemaCacheTTL == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(*c.SchemaCacheTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema_cache_ttl %q: %w", *c.SchemaCacheTTL, err)
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("invalid schema_cache_ttl %q: must not be negative", *c.SchemaCacheTTL)
+	}
+	return ttl, nil
+}
+
+// GetSchemaCacheDir returns the directory where the schema cache files are stored, which defaults to a directory under
+// the user's cache directory (e.g. ~/.cache/steampipe-plugin-mongodb on Linux)
+func (c MongoDBConfig) GetSchemaCacheDir() (string, error) {
+	if c.SchemaCacheDir != nil && *c.SchemaCacheDir != "" {
+		return *c.SchemaCacheDir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("couldn't find a directory for the schema cache, please set schema_cache_dir: %w", err)
+	}
+	return filepath.Join(cacheDir, "steampipe-plugin-mongodb"), nil
+}
+
+// Strategies for the columns of fields that have values of several types, see [MongoDBConfig.MixedTypeStrategy]
+const (
+	// mixedTypeJSONB presents them as JSONB columns, with each value as it is
+	mixedTypeJSONB = "jsonb"
+	// mixedTypeWiden presents them with the narrowest type that all the values can be converted to, see
+	// [analyzer.MixedType.Widen], or as JSONB if there's none
+	mixedTypeWiden = "widen"
+	// mixedTypeMajority presents them with the most common type on the sampled documents, values of other types are
+	// converted to it when possible, and are NULL otherwise
+	mixedTypeMajority = "majority"
+)
+
+// GetMixedTypeStrategy returns the strategy for fields with several types, which defaults to mixedTypeJSONB
+func (c MongoDBConfig) GetMixedTypeStrategy() (string, error) {
+	if c.MixedTypeStrategy == nil || *c.MixedTypeStrategy == "" {
+		return mixedTypeJSONB, nil
+	}
+	switch *c.MixedTypeStrategy {
+	case mixedTypeJSONB, mixedTypeWiden, mixedTypeMajority:
+		return *c.MixedTypeStrategy, nil
+	default:
+		return "", fmt.Errorf("invalid mixed_type_strategy %q, must be one of %s, %s or %s", *c.MixedTypeStrategy, mixedTypeJSONB, mixedTypeWiden, mixedTypeMajority)
+	}
+}
+
 /*
 GetSampleSize returns the sample size that has been set on the plugin config, falling back to 1000 as a default value
 */
@@ -95,3 +294,16 @@ func (c MongoDBConfig) GetFieldsToIgnore(collection string) []string {
 	}
 	return fieldsForCollection
 }
+
+// GetChildTables returns the paths of the arrays of a collection that should be exposed as child tables, see
+// [MongoDBConfig.ChildTables]. Items are in the same "collection:path" format as [MongoDBConfig.FieldsToIgnore]
+func (c MongoDBConfig) GetChildTables(collection string) []string {
+	collectionPrefix := fmt.Sprintf("%s:", collection)
+	paths := make([]string, 0)
+	for _, item := range c.ChildTables {
+		if path, ok := strings.CutPrefix(item, collectionPrefix); ok && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,140 @@
+package mongodb
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// parseConfig parses a connection config in the same way that the Steampipe SDK does for configs that use hcl tags
+func parseConfig(t *testing.T, config string) MongoDBConfig {
+	file, diags := hclsyntax.ParseConfig([]byte(config), "", hcl.Pos{})
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	var parsed MongoDBConfig
+	if diags := gohcl.DecodeBody(file.Body, nil, &parsed); diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	return parsed
+}
+
+func TestParseConfig(t *testing.T) {
+	config := parseConfig(t, `
+databases = ["tenant_*"]
+sample_size = 50
+fields_to_ignore = ["users:password"]`)
+
+	if !reflect.DeepEqual(config.Databases, []string{"tenant_*"}) {
+		t.Errorf("Expected databases to be [tenant_*] but they were %v", config.Databases)
+	}
+	if config.GetSampleSize() != 50 {
+		t.Errorf("Expected sample_size to be 50 but it was %d", config.GetSampleSize())
+	}
+	if fields := config.GetFieldsToIgnore("users"); !reflect.DeepEqual(fields, []string{"password"}) {
+		t.Errorf("Expected fields to ignore on users to be [password] but they were %v", fields)
+	}
+	if config.ConnectionString != nil || config.SchemaGroup != nil {
+		t.Errorf("Expected unset args to be nil")
+	}
+}
+
+func TestParseViews(t *testing.T) {
+	config := parseConfig(t, `
+database = "app"
+views = [
+  { name = "active_users", collection = "users", pipeline = "[{\"$match\": {\"active\": true}}]" },
+  { name = "big_orders", database = "shop", collection = "orders", pipeline = "[]" },
+]`)
+
+	views, err := config.GetViews()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ViewConfig{
+		{Name: "active_users", Database: "app", Collection: "users", Pipeline: `[{"$match": {"active": true}}]`},
+		{Name: "big_orders", Database: "shop", Collection: "orders", Pipeline: "[]"},
+	}
+	if !reflect.DeepEqual(views, expected) {
+		t.Errorf("Expected views to be %v but they were %v", expected, views)
+	}
+}
+
+func TestViewsRequireDatabaseWithSeveralDatabases(t *testing.T) {
+	config := parseConfig(t, `
+databases = ["tenant_*"]
+views = [{ name = "active_users", collection = "users", pipeline = "[]" }]`)
+
+	if _, err := config.GetViews(); err == nil {
+		t.Errorf("Expected an error when a view has no database and several databases are exposed")
+	}
+}
+
+func TestViewsRejectUnknownKeys(t *testing.T) {
+	config := parseConfig(t, `
+database = "app"
+views = [{ name = "active_users", collection = "users", pipeline = "[]", colection = "typo" }]`)
+
+	if _, err := config.GetViews(); err == nil {
+		t.Errorf("Expected an error when a view has an unknown key")
+	}
+}
+
+func TestSchemaCacheTTL(t *testing.T) {
+	cases := map[string]struct {
+		config   string
+		expected time.Duration
+		isError  bool
+	}{
+		"unset":    {config: `database = "app"`, expected: 0},
+		"set":      {config: `schema_cache_ttl = "24h"`, expected: 24 * time.Hour},
+		"disabled": {config: `schema_cache_ttl = "0"`, expected: 0},
+		"invalid":  {config: `schema_cache_ttl = "a day"`, isError: true},
+		"negative": {config: `schema_cache_ttl = "-1h"`, isError: true},
+	}
+	for name, tc := range cases {
+		ttl, err := parseConfig(t, tc.config).GetSchemaCacheTTL()
+		if tc.isError != (err != nil) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		if ttl != tc.expected {
+			t.Errorf("%s: expected TTL to be %s but it was %s", name, tc.expected, ttl)
+		}
+	}
+}
+
+func TestMixedTypeStrategy(t *testing.T) {
+	cases := map[string]struct {
+		config   string
+		expected string
+		isError  bool
+	}{
+		"unset":    {config: `database = "app"`, expected: mixedTypeJSONB},
+		"widen":    {config: `mixed_type_strategy = "widen"`, expected: mixedTypeWiden},
+		"majority": {config: `mixed_type_strategy = "majority"`, expected: mixedTypeMajority},
+		"invalid":  {config: `mixed_type_strategy = "text"`, isError: true},
+	}
+	for name, tc := range cases {
+		strategy, err := parseConfig(t, tc.config).GetMixedTypeStrategy()
+		if tc.isError != (err != nil) {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		if strategy != tc.expected {
+			t.Errorf("%s: expected strategy to be %q but it was %q", name, tc.expected, strategy)
+		}
+	}
+}
+
+func TestChildTables(t *testing.T) {
+	config := parseConfig(t, `child_tables = ["orders:line_items", "orders:shipping.packages", "users:addresses", "orders:"]`)
+
+	if paths := config.GetChildTables("orders"); !reflect.DeepEqual(paths, []string{"line_items", "shipping.packages"}) {
+		t.Errorf("Expected the arrays of orders, got %v", paths)
+	}
+	if paths := config.GetChildTables("products"); len(paths) > 0 {
+		t.Errorf("Expected no child tables for products, got %v", paths)
+	}
+}
@@ -0,0 +1,202 @@
+package mongodb
+
+import (
+	"fmt"
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+	"strings"
+)
+
+// declaredSchema is a [CollectionSchemaConfig] that has been validated and converted into analyzer types
+type declaredSchema struct {
+	Precedence string
+	// Types holds the type of each declared column, keyed by field path like an inferred schema is
+	Types analyzer.StructType
+	// Paths maps the declared columns whose name isn't the path of their field to that path
+	Paths columnPaths
+}
+
+/*
+parseDeclaredType converts the type of a declared column into an analyzer type. It accepts the names of the BSON
+primitive types (as returned by [analyzer.PrimitiveType.String], e.g. "string", "int32", "double", "decimal", "bool",
+"date", "timestamp", "objectId" or "binary"), plus "object" and "array", which are presented as JSONB columns
+*/
+func parseDeclaredType(name string) (analyzer.Type, error) {
+	switch name {
+	case "object":
+		return analyzer.StructType{}, nil // an empty struct isn't flattened into subcolumns
+	case "array":
+		return analyzer.SliceType{Type: analyzer.MixedType{}}, nil
+	}
+	if p, ok := analyzer.PrimitiveTypeByName(name); ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", name)
+}
+
+// getDeclaredSchema validates the declared schema of a collection, see [MongoDBConfig.GetCollectionSchema]
+func getDeclaredSchema(config *CollectionSchemaConfig) (*declaredSchema, error) {
+	precedence, err := config.GetPrecedence()
+	if err != nil {
+		return nil, err
+	}
+	schema := &declaredSchema{Precedence: precedence, Types: analyzer.StructType{}, Paths: columnPaths{}}
+
+	names := map[string]bool{}
+	for _, column := range config.Columns {
+		path := column.GetPath()
+		switch {
+		case names[column.Name]:
+			return nil, fmt.Errorf("column %s is declared twice on collection_schema %s", column.Name, config.Collection)
+		case strings.HasPrefix(path, "$") || strings.Contains(path, "..") || strings.HasSuffix(path, "."):
+			return nil, fmt.Errorf("invalid path %q for column %s on collection_schema %s", path, column.Name, config.Collection)
+		case column.Name != path && strings.Contains(column.Name, "."):
+			// Dotted names are field paths, so renaming a field into another path would be ambiguous
+			return nil, fmt.Errorf("column %s on collection_schema %s has a path, so its name can't contain dots", column.Name, config.Collection)
+		}
+		names[column.Name] = true
+
+		t, err := parseDeclaredType(column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s on collection_schema %s: %w", column.Name, config.Collection, err)
+		}
+		setTypeAtPath(schema.Types, path, t, true)
+		if column.Name != path {
+			schema.Paths[column.Name] = path
+		}
+	}
+	return schema, nil
+}
+
+/*
+setTypeAtPath sets the type of the field at a dotted path (e.g. "customer.name") on typeMap, creating the intermediate
+documents if needed. If the field (or one of its ancestors) already has a type, it's only replaced if overwrite is true,
+and in that case an ancestor that wasn't a document is replaced by one
+*/
+func setTypeAtPath(typeMap analyzer.StructType, path string, t analyzer.Type, overwrite bool) {
+	components := strings.Split(path, ".")
+	current := typeMap
+	for _, component := range components[:len(components)-1] {
+		child, ok := current[component].(analyzer.StructType)
+		if !ok {
+			if _, exists := current[component]; exists && !overwrite {
+				return
+			}
+			child = analyzer.StructType{}
+			current[component] = child
+		}
+		current = child
+	}
+
+	last := components[len(components)-1]
+	if _, exists := current[last]; exists && !overwrite {
+		return
+	}
+	current[last] = t
+}
+
+/*
+mergeDeclaredSchema merges the declared types into the inferred schema, according to the precedence of the declared
+schema. The inferred schema isn't modified, a merged copy is returned
+*/
+func mergeDeclaredSchema(inferred analyzer.StructType, declared *declaredSchema) analyzer.StructType {
+	if declared.Precedence == schemaPrecedenceOnly {
+		return analyzer.Copy(declared.Types).(analyzer.StructType)
+	}
+
+	merged := analyzer.StructType{}
+	if inferred != nil {
+		merged = analyzer.Copy(inferred).(analyzer.StructType)
+	}
+	overwrite := declared.Precedence == schemaPrecedenceDeclared
+	for path, t := range flattenSchema("", declared.Types) {
+		setTypeAtPath(merged, path, analyzer.Copy(t), overwrite)
+	}
+	return merged
+}
+
+// flattenSchema returns the types of the fields that become columns, keyed by their full path, in the same way as
+// [mongoFieldToSteampipeCol]: documents with fields are flattened, and empty documents (e.g. declared "object" columns)
+// are columns themselves
+func flattenSchema(prefix string, types analyzer.StructType) map[string]analyzer.Type {
+	flat := map[string]analyzer.Type{}
+	for name, t := range types {
+		path := joinPath(prefix, name)
+		if child, ok := t.(analyzer.StructType); ok && len(child) > 0 {
+			for childPath, childType := range flattenSchema(path, child) {
+				flat[childPath] = childType
+			}
+			continue
+		}
+		flat[path] = t
+	}
+	return flat
+}
+
+/*
+columnPaths maps the names of columns to the paths of the fields that back them, for the declared columns whose name
+isn't the path of their field (all other columns are named after their path). Everything that talks to MongoDB works
+with field paths, so the quals, the columns and the requested columns are translated before being used
+*/
+type columnPaths map[string]string
+
+// path returns the path of the field that backs a column
+func (p columnPaths) path(colName string) string {
+	if path, ok := p[colName]; ok {
+		return path
+	}
+	return colName
+}
+
+// name returns the name of the column that is backed by the field at path
+func (p columnPaths) name(path string) string {
+	for name, fieldPath := range p {
+		if fieldPath == path {
+			return name
+		}
+	}
+	return path
+}
+
+// paths translates a list of column names into field paths
+func (p columnPaths) paths(colNames []string) []string {
+	paths := make([]string, len(colNames))
+	for i, colName := range colNames {
+		paths[i] = p.path(colName)
+	}
+	return paths
+}
+
+// columns returns copies of the columns, named after their field paths
+func (p columnPaths) columns(cols []*plugin.Column) []*plugin.Column {
+	if len(p) == 0 {
+		return cols
+	}
+	renamed := make([]*plugin.Column, len(cols))
+	for i, col := range cols {
+		renamedCol := *col
+		renamedCol.Name = p.path(col.Name)
+		renamed[i] = &renamedCol
+	}
+	return renamed
+}
+
+// quals returns copies of the quals, with their columns replaced by field paths
+func (p columnPaths) quals(inputQuals plugin.KeyColumnQualMap) plugin.KeyColumnQualMap {
+	if len(p) == 0 {
+		return inputQuals
+	}
+	renamed := make(plugin.KeyColumnQualMap, len(inputQuals))
+	for colName, filteredColumn := range inputQuals {
+		path := p.path(colName)
+		renamedQuals := make(quals.QualSlice, len(filteredColumn.Quals))
+		for i, qual := range filteredColumn.Quals {
+			renamedQual := *qual
+			renamedQual.Column = path
+			renamedQuals[i] = &renamedQual
+		}
+		renamed[path] = &plugin.KeyColumnQuals{Name: path, Quals: renamedQuals}
+	}
+	return renamed
+}
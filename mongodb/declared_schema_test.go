@@ -0,0 +1,187 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+func TestParseCollectionSchema(t *testing.T) {
+	config := parseConfig(t, `
+database = "shop"
+
+collection_schema "orders" {
+  precedence = "only"
+
+  column "_id" {
+    type = "objectId"
+  }
+  column "amount" {
+    type = "decimal"
+  }
+  column "customer_name" {
+    path = "customer.name"
+    type = "string"
+  }
+}
+
+collection_schema "users" {
+  database = "accounts"
+
+  column "tags" {
+    type = "array"
+  }
+}`)
+
+	if schema := config.GetCollectionSchema("shop", "users"); schema != nil {
+		t.Errorf("Expected users on shop to have no declared schema, got %v", schema)
+	}
+	if schema := config.GetCollectionSchema("accounts", "users"); schema == nil || len(schema.Columns) != 1 {
+		t.Errorf("Expected users on accounts to have a declared schema with one column, got %v", schema)
+	}
+
+	declared, err := getDeclaredSchema(config.GetCollectionSchema("shop", "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTypes := analyzer.StructType{
+		"_id":      analyzer.PrimitiveObjectId,
+		"amount":   analyzer.PrimitiveDecimal,
+		"customer": analyzer.StructType{"name": analyzer.PrimitiveString},
+	}
+	if declared.Precedence != schemaPrecedenceOnly {
+		t.Errorf("Expected precedence %s but got %s", schemaPrecedenceOnly, declared.Precedence)
+	}
+	if !reflect.DeepEqual(declared.Types, expectedTypes) {
+		t.Errorf("Expected types %v but got %v", expectedTypes, declared.Types)
+	}
+	if expected := (columnPaths{"customer_name": "customer.name"}); !reflect.DeepEqual(declared.Paths, expected) {
+		t.Errorf("Expected paths %v but got %v", expected, declared.Paths)
+	}
+}
+
+func TestInvalidCollectionSchemas(t *testing.T) {
+	testCases := map[string]string{
+		"unknown type":     `column "amount" { type = "money" }`,
+		"duplicate column": "column \"amount\" { type = \"double\" }\ncolumn \"amount\" { type = \"decimal\" }",
+		"operator path": `column "amount" {
+  path = "$amount"
+  type = "double"
+}`,
+		"empty path segment": `column "amount" {
+  path = "a..b"
+  type = "double"
+}`,
+		"dotted renamed name": `column "a.b" {
+  path = "c"
+  type = "double"
+}`,
+		"unknown precedence": `precedence = "sampled"`,
+	}
+	for name, body := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config := parseConfig(t, "collection_schema \"orders\" {\n"+body+"\n}")
+			if _, err := getDeclaredSchema(config.GetCollectionSchema("", "orders")); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestMergeDeclaredSchema(t *testing.T) {
+	inferred := analyzer.StructType{
+		"_id":    analyzer.PrimitiveObjectId,
+		"amount": analyzer.MixedType{analyzer.PrimitiveDouble, analyzer.PrimitiveString},
+		"customer": analyzer.StructType{
+			"name":  analyzer.PrimitiveString,
+			"email": analyzer.PrimitiveString,
+		},
+		"notes": analyzer.PrimitiveString,
+	}
+	declared := analyzer.StructType{
+		"amount":   analyzer.PrimitiveDouble,
+		"customer": analyzer.StructType{"phone": analyzer.PrimitiveString},
+		"notes":    analyzer.StructType{"author": analyzer.PrimitiveString},
+	}
+
+	testCases := map[string]analyzer.StructType{
+		schemaPrecedenceDeclared: {
+			"_id":    analyzer.PrimitiveObjectId,
+			"amount": analyzer.PrimitiveDouble,
+			"customer": analyzer.StructType{
+				"name":  analyzer.PrimitiveString,
+				"email": analyzer.PrimitiveString,
+				"phone": analyzer.PrimitiveString,
+			},
+			"notes": analyzer.StructType{"author": analyzer.PrimitiveString},
+		},
+		schemaPrecedenceInferred: {
+			"_id":    analyzer.PrimitiveObjectId,
+			"amount": analyzer.MixedType{analyzer.PrimitiveDouble, analyzer.PrimitiveString},
+			"customer": analyzer.StructType{
+				"name":  analyzer.PrimitiveString,
+				"email": analyzer.PrimitiveString,
+				"phone": analyzer.PrimitiveString,
+			},
+			"notes": analyzer.PrimitiveString,
+		},
+		schemaPrecedenceOnly: declared,
+	}
+	for precedence, expected := range testCases {
+		t.Run(precedence, func(t *testing.T) {
+			inferredCopy := analyzer.Copy(inferred).(analyzer.StructType)
+			merged := mergeDeclaredSchema(inferredCopy, &declaredSchema{Precedence: precedence, Types: declared})
+			if !reflect.DeepEqual(merged, expected) {
+				t.Errorf("Expected %v but got %v", expected, merged)
+			}
+			if !reflect.DeepEqual(inferredCopy, inferred) {
+				t.Errorf("Merging modified the inferred schema: %v", inferredCopy)
+			}
+		})
+	}
+}
+
+func TestDeclaredObjectIsAColumn(t *testing.T) {
+	declared, err := getDeclaredSchema(&CollectionSchemaConfig{Collection: "orders", Columns: []CollectionColumnConfig{
+		{Name: "metadata", Type: "object"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inferred := analyzer.StructType{"metadata": analyzer.StructType{"source": analyzer.PrimitiveString}}
+	merged := mergeDeclaredSchema(inferred, declared)
+
+	colTypes, err := convertMongoTypeToColumnTypes(ctx(), merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]proto.ColumnType{"metadata": proto.ColumnType_JSON}; !reflect.DeepEqual(colTypes, expected) {
+		t.Errorf("Expected %v but got %v", expected, colTypes)
+	}
+}
+
+func TestColumnPathsTranslateQuals(t *testing.T) {
+	paths := columnPaths{"customer_name": "customer.name"}
+	typeMap := analyzer.StructType{"customer": analyzer.StructType{"name": analyzer.PrimitiveString}}
+	cols := []*plugin.Column{{Name: "customer_name", Type: proto.ColumnType_STRING}}
+	inputQuals := makeQual("customer_name", "=", "Alice")
+
+	filter, _ := qualsToMongoFilter(ctx(), paths.quals(inputQuals), paths.columns(cols), typeMap)
+	if expected := (bson.D{{"customer.name", bson.M{"$eq": "Alice"}}}); !reflect.DeepEqual(filter, expected) {
+		t.Errorf("Expected filter to be %v but it was %v", expected, filter)
+	}
+	if cols[0].Name != "customer_name" || inputQuals["customer_name"].Quals[0].Column != "customer_name" {
+		t.Errorf("Translating the columns and quals modified the originals")
+	}
+
+	projection := columnsToProjection(paths.paths([]string{"customer_name"}), paths.columns(cols))
+	if expected := (bson.D{{"customer.name", 1}, {"_id", 0}}); !reflect.DeepEqual(projection, expected) {
+		t.Errorf("Expected projection to be %v but it was %v", expected, projection)
+	}
+	if name := paths.name("customer.name"); name != "customer_name" {
+		t.Errorf("Expected customer.name to be presented as customer_name, got %s", name)
+	}
+}
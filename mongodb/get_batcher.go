@@ -0,0 +1,193 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/turbot/go-kit/helpers"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// getBatchWindow is how long a batch waits for more Get calls before it's sent
+	getBatchWindow = 5 * time.Millisecond
+	// getBatchMaxSize is the max number of values on a single $in, once it's reached the batch is sent immediately
+	getBatchMaxSize = 100
+)
+
+/*
+getBatcher groups concurrent Get calls on the same field of the same collection into a single {field: {$in: [...]}}
+query. Steampipe runs one Get call per value for queries such as WHERE _id IN (...), and all of them start at roughly the
+same time, so waiting a few milliseconds before sending the query turns N round trips into one
+*/
+type getBatcher struct {
+	mu      sync.Mutex
+	pending map[string]*getBatch
+}
+
+type getBatch struct {
+	coll   *mongo.Collection
+	field  string
+	values []any
+	once   sync.Once
+	done   chan struct{}
+	// results and err are only valid after done is closed
+	results map[string]bson.M
+	err     error
+}
+
+var getBatches = &getBatcher{pending: map[string]*getBatch{}}
+
+// get returns the document whose field is equal to value, or nil if there is none
+func (b *getBatcher) get(ctx context.Context, connectionName string, coll *mongo.Collection, field string, value any) (bson.M, error) {
+	key := fmt.Sprintf("%s/%s/%s/%s", connectionName, coll.Database().Name(), coll.Name(), field)
+
+	b.mu.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &getBatch{coll: coll, field: field, done: make(chan struct{})}
+		b.pending[key] = batch
+		// The query mustn't be cancelled if the Get call that started the batch is, since others are waiting on it too
+		batchCtx := context.WithoutCancel(ctx)
+		time.AfterFunc(getBatchWindow, func() { b.flush(batchCtx, key, batch) })
+	}
+	alternatives := getBatchValues(value)
+	batch.values = append(batch.values, alternatives...)
+	full := len(batch.values) >= getBatchMaxSize
+	b.mu.Unlock()
+
+	if full {
+		b.flush(context.WithoutCancel(ctx), key, batch)
+	}
+
+	select {
+	case <-batch.done:
+		if batch.err != nil {
+			return nil, batch.err
+		}
+		for _, alternative := range alternatives {
+			if doc, ok := batch.results[getBatchKey(alternative)]; ok {
+				return doc, nil
+			}
+		}
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush sends the query for a batch, unless it has already been sent
+func (b *getBatcher) flush(ctx context.Context, key string, batch *getBatch) {
+	batch.once.Do(func() {
+		b.mu.Lock()
+		if b.pending[key] == batch {
+			delete(b.pending, key) // later calls start a new batch
+		}
+		values := batch.values
+		b.mu.Unlock()
+
+		defer close(batch.done)
+		plugin.Logger(ctx).Debug("mongodb.getBatcher", "collection", batch.coll.Name(), "field", batch.field, "values", len(values))
+		cursor, err := batch.coll.Find(ctx, bson.D{{Key: batch.field, Value: bson.M{"$in": values}}})
+		if err != nil {
+			batch.err = err
+			return
+		}
+		defer cursor.Close(ctx)
+
+		batch.results = make(map[string]bson.M, len(values))
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				batch.err = err
+				return
+			}
+			fieldValue, _ := helpers.GetNestedFieldValueFromInterface(doc, batch.field)
+			for _, key := range getBatchKeys(fieldValue) {
+				batch.results[key] = doc
+			}
+		}
+		batch.err = cursor.Err()
+	})
+}
+
+// getBatchValues returns the values that a document may have to match value, which are several for [binaryAlternatives]
+func getBatchValues(value any) []any {
+	alternatives, ok := value.(binaryAlternatives)
+	if !ok {
+		return []any{value}
+	}
+	values := make([]any, len(alternatives))
+	for i, alternative := range alternatives {
+		values[i] = alternative
+	}
+	return values
+}
+
+/*
+getBatchKeys returns the keys under which a document whose field has value v is stored on the results of a batch. $in
+matches a field that holds an array if any of its elements matches (e.g. on fields with a multikey index), so arrays
+are stored under the key of each element
+*/
+func getBatchKeys(v any) []string {
+	elements, ok := v.(primitive.A)
+	if !ok {
+		return []string{getBatchKey(v)}
+	}
+	keys := make([]string, len(elements))
+	for i, element := range elements {
+		keys[i] = getBatchKey(element)
+	}
+	return keys
+}
+
+/*
+getBatchKey returns the key under which the document that has a certain value is stored on the results of a batch.
+MongoDB considers numbers of different types to be equal, and dates may come in as either [time.Time] (on the query) or
+[primitive.DateTime] (on the documents), so those are normalized before building the key. Decimal128 values are
+normalized by their exact value, so e.g. 1.10 and 1.1 are the same, and 2 is the same as the integer 2
+*/
+func getBatchKey(v any) string {
+	switch value := v.(type) {
+	case int32:
+		return "number:" + strconv.FormatInt(int64(value), 10)
+	case int64:
+		return "number:" + strconv.FormatInt(value, 10)
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return "number:" + strconv.FormatInt(int64(value), 10) // so 2.0 and 2 are the same
+		}
+		return "number:" + strconv.FormatFloat(value, 'g', -1, 64)
+	case time.Time:
+		return "date:" + strconv.FormatInt(value.UnixMilli(), 10)
+	case primitive.DateTime:
+		return "date:" + strconv.FormatInt(int64(value), 10)
+	case primitive.Decimal128:
+		mantissa, exp, err := value.BigInt()
+		if err != nil { // NaN and infinities
+			return "number:" + value.String()
+		}
+		exact := new(big.Rat)
+		if exp >= 0 {
+			exact.SetInt(mantissa.Mul(mantissa, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)))
+		} else {
+			exact.SetFrac(mantissa, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-exp)), nil))
+		}
+		if exact.IsInt() && exact.Num().IsInt64() {
+			return getBatchKey(exact.Num().Int64())
+		}
+		if asFloat, ok := exact.Float64(); ok {
+			return getBatchKey(asFloat) // MongoDB only considers it equal to a double if the double has the exact same value
+		}
+		return "number:" + exact.RatString()
+	default:
+		return fmt.Sprintf("%T:%v", v, v)
+	}
+}
@@ -0,0 +1,78 @@
+package mongodb
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetBatchKey(t *testing.T) {
+	oid := primitive.NewObjectID()
+	date := time.UnixMilli(1704067200123)
+
+	decimal := func(s string) primitive.Decimal128 {
+		d, err := primitive.ParseDecimal128(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	same := [][]any{
+		{int32(2), int64(2), 2.0, decimal("2"), decimal("2.00"), decimal("0.2E1")},
+		{decimal("1.1"), decimal("1.10")},
+		{2.5, decimal("2.5")},
+		{int64(1 << 60), decimal("1152921504606846976")},
+		{date, primitive.NewDateTimeFromTime(date)},
+		{oid, oid},
+		{"abc", "abc"},
+	}
+	for _, values := range same {
+		for _, v := range values[1:] {
+			if getBatchKey(values[0]) != getBatchKey(v) {
+				t.Errorf("Expected %#v and %#v to have the same key, but they were %s and %s", values[0], v, getBatchKey(values[0]), getBatchKey(v))
+			}
+		}
+	}
+
+	different := [][2]any{
+		{int64(2), 2.5},
+		{int64(1 << 60), int64(1<<60 + 1)},
+		{"2", int64(2)},
+		{oid.Hex(), oid},
+		{decimal("1.1"), 1.1}, // MongoDB compares them exactly, and 1.1 isn't exact as a double
+		{decimal("1.1"), decimal("1.2")},
+		{decimal("NaN"), decimal("1")},
+	}
+	for _, pair := range different {
+		if getBatchKey(pair[0]) == getBatchKey(pair[1]) {
+			t.Errorf("Expected %#v and %#v to have different keys, but both were %s", pair[0], pair[1], getBatchKey(pair[0]))
+		}
+	}
+}
+
+func TestGetBatchValues(t *testing.T) {
+	uuid4 := primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: make([]byte, 16)}
+	uuid3 := primitive.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: make([]byte, 16)}
+
+	if values := getBatchValues("abc"); !reflect.DeepEqual(values, []any{"abc"}) {
+		t.Errorf("Expected a single value, got %v", values)
+	}
+	if values := getBatchValues(binaryAlternatives{uuid4, uuid3}); !reflect.DeepEqual(values, []any{uuid4, uuid3}) {
+		t.Errorf("Expected each alternative to be a value, got %v", values)
+	}
+}
+
+func TestGetBatchKeys(t *testing.T) {
+	if keys := getBatchKeys("abc"); !reflect.DeepEqual(keys, []string{getBatchKey("abc")}) {
+		t.Errorf("Expected a single key, got %v", keys)
+	}
+	// Fields with a multikey index hold arrays, and $in matched the document because of one of their elements
+	keys := getBatchKeys(primitive.A{"a", int32(2)})
+	expected := []string{getBatchKey("a"), getBatchKey(int64(2))}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected a key per element %v, got %v", expected, keys)
+	}
+}
@@ -0,0 +1,163 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+/*
+resolveColumnType returns the type of the column for a field of type t, according to strategy (see
+[MongoDBConfig.MixedTypeStrategy]). Only fields with several types (apart from nil) are affected, all others get the type
+from [getSteampipeTypeForMongoType]. field are the statistics of the field, which are needed for mixedTypeMajority, if
+they're not available (e.g. the field was declared) the type is widened instead.
+
+coerce is true if the values of the field must be converted to the type of the column, see [coerceToColumnType]
+*/
+func resolveColumnType(ctx context.Context, t analyzer.Type, strategy string, field *analyzer.FieldStats) (columnType proto.ColumnType, coerce bool) {
+	mixed, ok := t.(analyzer.MixedType)
+	if !ok || mixed.IsNilAndOther() || strategy == mixedTypeJSONB {
+		return getSteampipeTypeForMongoType(ctx, t), false
+	}
+
+	if strategy == mixedTypeMajority && field != nil {
+		types := sortedFieldTypes(*field)
+		if len(types) == 0 {
+			return proto.ColumnType_JSON, false
+		}
+		majority, ok := analyzer.PrimitiveTypeByName(types[0])
+		if !ok {
+			return proto.ColumnType_JSON, false // the most common type is a document or an array
+		}
+		if columnType := getSteampipeTypeForMongoType(ctx, majority); columnType != proto.ColumnType_UNKNOWN {
+			return columnType, columnType != proto.ColumnType_JSON
+		}
+		return proto.ColumnType_JSON, false
+	}
+
+	if widened, ok := mixed.Widen(); ok {
+		return getSteampipeTypeForMongoType(ctx, widened), true
+	}
+	return proto.ColumnType_JSON, false
+}
+
+/*
+mixedTypeFilterable reports whether quals on a column of type columnType, built from a field with several types, can be
+sent to MongoDB. That's only the case if the column has the widened type of the field (see [analyzer.MixedType.Widen])
+and if MongoDB compares every member type in the same way as Postgres compares the coerced values:
+  - Int32 and Int64 are both exact on INT columns, and Int32 is exact on DOUBLE columns too, but Int64 values above 2^53
+    are rounded when coerced to DOUBLE, so they could match on Postgres but not on MongoDB
+  - Decimal128 never qualifies, since MongoDB compares it exactly against doubles (see [jsonScalarToMongo])
+  - Strings can only be mixed with symbols, e.g. ObjectIDs are presented as strings but never match a string on MongoDB
+*/
+func mixedTypeFilterable(ctx context.Context, mixed analyzer.MixedType, columnType proto.ColumnType) bool {
+	widened, ok := mixed.Widen()
+	if !ok || getSteampipeTypeForMongoType(ctx, widened) != columnType {
+		return false
+	}
+	var allowed []analyzer.Type
+	switch widened {
+	case analyzer.PrimitiveInt64:
+		allowed = []analyzer.Type{analyzer.PrimitiveInt32, analyzer.PrimitiveInt64}
+	case analyzer.PrimitiveDouble:
+		allowed = []analyzer.Type{analyzer.PrimitiveInt32, analyzer.PrimitiveDouble}
+	case analyzer.PrimitiveString:
+		allowed = []analyzer.Type{analyzer.PrimitiveString, analyzer.PrimitiveSymbol}
+	}
+	return !slices.ContainsFunc(mixed, func(t analyzer.Type) bool {
+		return t != analyzer.NilType && !slices.Contains(allowed, t)
+	})
+}
+
+/*
+coerceToColumnType converts a value (already converted by [mongoTransformFunction]) to the type of its column, which is
+passed as the param, for columns whose fields have several types (see [resolveColumnType]). Values that can't be
+converted without losing information (e.g. 1.5 to an INT column, or "abc" to a DOUBLE column) become NULL
+*/
+func coerceToColumnType(ctx context.Context, d *transform.TransformData) (any, error) {
+	if d.Value == nil {
+		return nil, nil
+	}
+	coerced, ok := coerceValue(d.Value, d.Param.(proto.ColumnType))
+	if !ok {
+		plugin.Logger(ctx).Debug("mongodb.coerceToColumnType", "msg", "value doesn't fit the column, returning NULL", "column", d.ColumnName, "value", d.Value)
+		return nil, nil
+	}
+	return coerced, nil
+}
+
+// coerceValue converts v to a value of the column type, or returns false if it can't
+func coerceValue(v any, columnType proto.ColumnType) (any, bool) {
+	switch columnType {
+	case proto.ColumnType_INT:
+		switch n := v.(type) {
+		case int32:
+			return int64(n), true
+		case int64:
+			return n, true
+		case float64:
+			if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+				return int64(n), true
+			}
+		case string:
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return i, true
+			}
+		}
+	case proto.ColumnType_DOUBLE:
+		switch n := v.(type) {
+		case int32:
+			return float64(n), true
+		case int64:
+			return float64(n), true
+		case float64:
+			return n, true
+		case string:
+			if f, err := strconv.ParseFloat(n, 64); err == nil {
+				return f, true
+			}
+		}
+	case proto.ColumnType_STRING:
+		switch s := v.(type) {
+		case string:
+			return s, true
+		case int32:
+			return strconv.FormatInt(int64(s), 10), true
+		case int64:
+			return strconv.FormatInt(s, 10), true
+		case float64:
+			return strconv.FormatFloat(s, 'g', -1, 64), true
+		case bool:
+			return strconv.FormatBool(s), true
+		case time.Time:
+			return s.Format(time.RFC3339Nano), true
+		default:
+			if encoded, err := json.Marshal(s); err == nil {
+				return string(encoded), true // documents and arrays
+			}
+		}
+	case proto.ColumnType_BOOL:
+		if b, ok := v.(bool); ok {
+			return b, true
+		}
+	case proto.ColumnType_TIMESTAMP:
+		switch ts := v.(type) {
+		case time.Time:
+			return ts, true
+		case string:
+			if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				return parsed, true
+			}
+		}
+	case proto.ColumnType_JSON:
+		return v, true
+	}
+	return nil, false
+}
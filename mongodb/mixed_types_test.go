@@ -0,0 +1,111 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveColumnType(t *testing.T) {
+	numbers := analyzer.MixedType{analyzer.PrimitiveInt32, analyzer.PrimitiveDouble}
+	mostlyStrings := &analyzer.FieldStats{Count: 10, Types: map[string]int{"string": 7, "int32": 2, "null": 1}}
+	mostlyNull := &analyzer.FieldStats{Count: 10, Types: map[string]int{"null": 9, "object": 1}}
+	cases := map[string]struct {
+		t        analyzer.Type
+		strategy string
+		field    *analyzer.FieldStats
+		expected proto.ColumnType
+		coerce   bool
+	}{
+		"single type":             {t: analyzer.PrimitiveInt32, strategy: mixedTypeWiden, expected: proto.ColumnType_INT},
+		"nullable":                {t: analyzer.MixedType{analyzer.NilType, analyzer.PrimitiveString}, strategy: mixedTypeWiden, expected: proto.ColumnType_STRING},
+		"jsonb":                   {t: numbers, strategy: mixedTypeJSONB, expected: proto.ColumnType_JSON},
+		"widen numbers":           {t: numbers, strategy: mixedTypeWiden, expected: proto.ColumnType_DOUBLE, coerce: true},
+		"widen string-like":       {t: analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveObjectId}, strategy: mixedTypeWiden, expected: proto.ColumnType_STRING, coerce: true},
+		"can't widen":             {t: analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveInt32}, strategy: mixedTypeWiden, expected: proto.ColumnType_JSON},
+		"majority":                {t: analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveInt32}, strategy: mixedTypeMajority, field: mostlyStrings, expected: proto.ColumnType_STRING, coerce: true},
+		"majority ignores nulls":  {t: analyzer.MixedType{analyzer.PrimitiveString, analyzer.StructType{}}, strategy: mixedTypeMajority, field: mostlyNull, expected: proto.ColumnType_JSON},
+		"majority without stats":  {t: numbers, strategy: mixedTypeMajority, expected: proto.ColumnType_DOUBLE, coerce: true},
+		"majority can't be known": {t: analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveInt32}, strategy: mixedTypeMajority, expected: proto.ColumnType_JSON},
+	}
+	for name, tc := range cases {
+		columnType, coerce := resolveColumnType(ctx(), tc.t, tc.strategy, tc.field)
+		if columnType != tc.expected || coerce != tc.coerce {
+			t.Errorf("%s: expected %s (coerce=%v), got %s (coerce=%v)", name, tc.expected, tc.coerce, columnType, coerce)
+		}
+	}
+}
+
+func TestCoerceValue(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		value      any
+		columnType proto.ColumnType
+		expected   any
+		ok         bool
+	}{
+		{int32(1), proto.ColumnType_INT, int64(1), true},
+		{2.0, proto.ColumnType_INT, int64(2), true},
+		{2.5, proto.ColumnType_INT, nil, false},
+		{"3", proto.ColumnType_INT, int64(3), true},
+		{"abc", proto.ColumnType_INT, nil, false},
+		{int64(4), proto.ColumnType_DOUBLE, 4.0, true},
+		{"4.5", proto.ColumnType_DOUBLE, 4.5, true},
+		{true, proto.ColumnType_DOUBLE, nil, false},
+		{int32(5), proto.ColumnType_STRING, "5", true},
+		{5.5, proto.ColumnType_STRING, "5.5", true},
+		{false, proto.ColumnType_STRING, "false", true},
+		{date, proto.ColumnType_STRING, "2024-01-02T03:04:05Z", true},
+		{map[string]any{"a": 1}, proto.ColumnType_STRING, `{"a":1}`, true},
+		{"yes", proto.ColumnType_BOOL, nil, false},
+		{"2024-01-02T03:04:05Z", proto.ColumnType_TIMESTAMP, date, true},
+		{int64(0), proto.ColumnType_TIMESTAMP, nil, false},
+	}
+	for _, tc := range cases {
+		coerced, ok := coerceValue(tc.value, tc.columnType)
+		if ok != tc.ok || !reflect.DeepEqual(coerced, tc.expected) {
+			t.Errorf("%v (%T) to %s: expected %v (%v), got %v (%v)", tc.value, tc.value, tc.columnType, tc.expected, tc.ok, coerced, ok)
+		}
+	}
+}
+
+func TestMixedTypeQuals(t *testing.T) {
+	mixedTypeMap := analyzer.StructType{
+		"ints":     analyzer.MixedType{analyzer.PrimitiveInt32, analyzer.PrimitiveInt64},
+		"numbers":  analyzer.MixedType{analyzer.PrimitiveInt32, analyzer.PrimitiveDouble},
+		"big":      analyzer.MixedType{analyzer.PrimitiveInt64, analyzer.PrimitiveDouble},
+		"ids":      analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveObjectId},
+		"names":    analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveSymbol},
+		"majority": analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveInt32},
+	}
+	mixedColumns := []*plugin.Column{
+		{Name: "ints", Type: proto.ColumnType_INT},
+		{Name: "numbers", Type: proto.ColumnType_DOUBLE},
+		{Name: "big", Type: proto.ColumnType_DOUBLE},
+		{Name: "ids", Type: proto.ColumnType_STRING},
+		{Name: "names", Type: proto.ColumnType_STRING},
+		{Name: "majority", Type: proto.ColumnType_STRING},
+	}
+	cases := map[string]struct {
+		qual     plugin.KeyColumnQualMap
+		expected bson.D
+	}{
+		"ints":                 {qual: makeQual("ints", "=", int64(1)), expected: bson.D{{"ints", bson.M{"$eq": int64(1)}}}},
+		"numbers":              {qual: makeQual("numbers", ">", 1.5), expected: bson.D{{"numbers", bson.M{"$gt": 1.5}}}},
+		"int64 as double":      {qual: makeQual("big", "=", 1.0), expected: bson.D{}},
+		"strings and symbols":  {qual: makeQual("names", "=", "a"), expected: bson.D{{"names", bson.M{"$eq": "a"}}}},
+		"strings and ObjectId": {qual: makeQual("ids", "=", "a"), expected: bson.D{}},
+		"majority":             {qual: makeQual("majority", "=", "a"), expected: bson.D{}},
+		"majority is null":     {qual: makeQual("majority", "is null", nil), expected: bson.D{}},
+	}
+	for name, tc := range cases {
+		filter, _ := qualsToMongoFilter(ctx(), tc.qual, mixedColumns, mixedTypeMap)
+		if !reflect.DeepEqual(filter, tc.expected) {
+			t.Errorf("%s: expected filter to be %v but it was %v", name, tc.expected, filter)
+		}
+	}
+}
@@ -3,81 +3,201 @@ package mongodb
 import (
 	"context"
 	"fmt"
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
 	"github.com/turbot/go-kit/helpers"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/mongo"
 	"path"
 )
 
+// pluginInstance is the plugin that is being served, which is needed to ask Steampipe to reload the schema of other
+// connections, see [reconcileSchemaGroup]
+var pluginInstance *plugin.Plugin
+
 func Plugin(ctx context.Context) *plugin.Plugin {
 	p := &plugin.Plugin{
 		Name:             "steampipe-plugin-mongodb",
 		DefaultTransform: transform.FromGo().NullIfZero(),
 		ConnectionConfigSchema: &plugin.ConnectionConfigSchema{
 			NewInstance: ConfigInstance,
-			Schema:      ConfigSchema,
 		},
-		SchemaMode:   plugin.SchemaModeDynamic,
-		TableMapFunc: PluginTables,
+		SchemaMode:                  plugin.SchemaModeDynamic,
+		TableMapFunc:                PluginTables,
+		ConnectionConfigChangedFunc: connectionConfigChanged,
 	}
+	pluginInstance = p
 	return p
 }
 
 type key string
 
 const (
-	keyCollection key = "collection"
+	keyNamespace key = "namespace"
 )
 
+// namespace identifies a single collection on a single database, and is passed through the context to [tableMongoDB]
+type namespace struct {
+	Database   string
+	Collection string
+	// Type, TimeField, MetaField and OptionsHash come from [collectionInfo]
+	Type        string
+	TimeField   string
+	MetaField   string
+	OptionsHash string
+	// View and Pipeline are only set for the views that are declared on the config, in that case View is the name of
+	// the table and Pipeline is run on the collection to produce the documents
+	View     string
+	Pipeline mongo.Pipeline
+	// Unwind and ElementType are only set for child tables. Unwind is the path of the array whose elements are the rows
+	// (see [unwindPipeline]), and ElementType is the schema of those rows (see [childElementType])
+	Unwind      string
+	ElementType analyzer.StructType
+}
+
 func PluginTables(ctx context.Context, d *plugin.TableMapData) (map[string]*plugin.Table, error) {
 	tables := map[string]*plugin.Table{}
+	forgetTableSchemas(d.Connection.Name)
 
 	config := GetConfig(d.Connection)
 	connectionString, err := config.GetConnectionString()
 	if err != nil {
 		return nil, err
 	}
-	databaseName := config.Database
+	databasePatterns, err := config.GetDatabases()
+	if err != nil {
+		return nil, err
+	}
 
-	collections, err := getCollectionsOnDatabase(ctx, connectionString, databaseName)
+	client, err := getClient(ctx, d.ConnectionCache, d.Connection.Name, connectionString)
 	if err != nil {
-		plugin.Logger(ctx).Error("mongodb.PluginCollections", "get_collections_error", err)
+		plugin.Logger(ctx).Error("mongodb.PluginCollections", "connect_error", err)
 		return nil, err
 	}
-	fmt.Printf("connstring %s", connectionString)
-
-	tempCollectionNames := []string{} // this is to keep track of the collections that we've already added
-
-	plugin.Logger(ctx).Debug("mongodb.PluginCollections", "collections", collections, "patterns", config.GetCollectionsToExpose())
-	for _, pattern := range config.GetCollectionsToExpose() {
-		for _, collection := range collections {
-			if helpers.StringSliceContains(tempCollectionNames, collection) {
-				continue // we've already handled it before
-			} else if ok, _ := path.Match(pattern, collection); !ok {
-				plugin.Logger(ctx).Debug("mongodb.PluginCollections.noMatch", "pattern", pattern, "table", collection)
-				continue // pattern didn't match, don't do what follows
-			}
 
-			// here we're sure that pattern matched and it's the first time, so process this table
-			tempCollectionNames = append(tempCollectionNames, collection)
+	databases, err := getDatabasesMatching(ctx, client, databasePatterns)
+	if err != nil {
+		plugin.Logger(ctx).Error("mongodb.PluginCollections", "get_databases_error", err)
+		return nil, err
+	}
+
+	for _, databaseName := range databases {
+		collections, err := getCollectionsOnDatabase(ctx, client, databaseName, config.IncludeSystemCollections)
+		if err != nil {
+			plugin.Logger(ctx).Error("mongodb.PluginCollections", "get_collections_error", err, "database", databaseName)
+			return nil, err
+		}
+
+		tempCollectionNames := []string{} // this is to keep track of the collections that we've already added
+
+		plugin.Logger(ctx).Debug("mongodb.PluginCollections", "database", databaseName, "collections", collections, "patterns", config.GetCollectionsToExpose())
+		for _, pattern := range config.GetCollectionsToExpose() {
+			for _, info := range collections {
+				collection := info.Name
+				if helpers.StringSliceContains(tempCollectionNames, collection) {
+					continue // we've already handled it before
+				} else if ok, _ := path.Match(pattern, collection); !ok {
+					plugin.Logger(ctx).Debug("mongodb.PluginCollections.noMatch", "pattern", pattern, "table", collection)
+					continue // pattern didn't match, don't do what follows
+				}
+
+				// here we're sure that pattern matched and it's the first time, so process this table
+				tempCollectionNames = append(tempCollectionNames, collection)
 
-			// Pass the collection name as a context key, as the CSV plugin does with each file path
-			// See https://github.com/turbot/steampipe-plugin-csv/blob/cb5bbca5c9fdaa18a03ebd3953dbb0ab501b18bd/csv/plugin.go#L45
-			tableCtx := context.WithValue(ctx, keyCollection, collection)
+				tableName := config.GetTableName(databaseName, collection)
+				if _, ok := tables[tableName]; ok {
+					return nil, fmt.Errorf("table name %s is generated by more than one collection, please set table_name_format so it includes {database}", tableName)
+				}
 
-			tableSteampipe, err := tableMongoDB(tableCtx, d.Connection)
-			if err != nil {
-				plugin.Logger(ctx).Error("mongodb.PluginCollections", "create_table_error", err, "collectionName", collection)
-				return nil, err
+				// Pass the database and collection names as a context key, as the CSV plugin does with each file path
+				// See https://github.com/turbot/steampipe-plugin-csv/blob/cb5bbca5c9fdaa18a03ebd3953dbb0ab501b18bd/csv/plugin.go#L45
+				tableCtx := context.WithValue(ctx, keyNamespace, namespace{
+					Database:    databaseName,
+					Collection:  collection,
+					Type:        info.Type,
+					TimeField:   info.TimeField,
+					MetaField:   info.MetaField,
+					OptionsHash: info.OptionsHash,
+				})
+
+				tableSteampipe, err := tableMongoDB(tableCtx, client, d.Connection)
+				if err != nil {
+					plugin.Logger(ctx).Error("mongodb.PluginCollections", "create_table_error", err, "databaseName", databaseName, "collectionName", collection)
+					return nil, err
+				}
+
+				plugin.Logger(ctx).Debug("mongodb.PluginCollections.makeTables", "table", tableSteampipe)
+				tables[tableName] = tableSteampipe
+
+				for _, arrayPath := range config.GetChildTables(collection) {
+					childName := childTableName(tableName, arrayPath)
+					if _, ok := tables[childName]; ok {
+						return nil, fmt.Errorf("child table %s has the same name as another table", childName)
+					}
+					elementType, ok := childElementType(d.Connection.Name, tableName, arrayPath, config.GetFieldsToIgnore(childName))
+					if !ok {
+						// Not fatal, since it depends on the sampled documents (e.g. the collection may be empty)
+						plugin.Logger(ctx).Warn("mongodb.PluginCollections", "msg", "field isn't an array of documents, not creating a child table", "table", tableName, "field", arrayPath)
+						continue
+					}
+
+					childCtx := context.WithValue(ctx, keyNamespace, namespace{
+						Database:    databaseName,
+						Collection:  collection,
+						View:        childName,
+						Pipeline:    unwindPipeline(arrayPath),
+						Unwind:      arrayPath,
+						ElementType: elementType,
+					})
+					childTable, err := tableMongoDB(childCtx, client, d.Connection)
+					if err != nil {
+						plugin.Logger(ctx).Error("mongodb.PluginCollections", "create_child_table_error", err, "table", tableName, "field", arrayPath)
+						return nil, err
+					}
+					tables[childName] = childTable
+				}
 			}
+		}
+	}
 
-			plugin.Logger(ctx).Debug("mongodb.PluginCollections.makeTables", "table", tableSteampipe)
-			tables[collection] = tableSteampipe
+	views, err := config.GetViews()
+	if err != nil {
+		return nil, err
+	}
+	for _, view := range views {
+		if _, ok := tables[view.Name]; ok {
+			return nil, fmt.Errorf("view %s has the same name as a collection table", view.Name)
+		}
+		pipeline, err := parsePipeline(view.Pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pipeline on view %s: %w", view.Name, err)
+		}
+
+		tableCtx := context.WithValue(ctx, keyNamespace, namespace{Database: view.Database, Collection: view.Collection, View: view.Name, Pipeline: pipeline})
+		tableSteampipe, err := tableMongoDB(tableCtx, client, d.Connection)
+		if err != nil {
+			plugin.Logger(ctx).Error("mongodb.PluginCollections", "create_view_error", err, "viewName", view.Name)
+			return nil, err
 		}
+		tables[view.Name] = tableSteampipe
 	}
 
-	// Manually add the raw table (that one will always exist, in addition to an unknown number of dynamic tables)
-	//tables["raw"] = tableRawQuery(ctx, d.Connection)
+	// Manually add the static tables (those will always exist, in addition to an unknown number of dynamic tables)
+	staticTables := []*plugin.Table{
+		tableMongoDBDatabase(ctx, d.Connection),
+		tableMongoDBCollection(ctx, d.Connection),
+		tableMongoDBIndex(ctx, d.Connection),
+		tableMongoDBRawFind(ctx, d.Connection),
+		tableMongoDBAggregate(ctx, d.Connection),
+		tableMongoDBSchemaDrift(ctx, d.Connection),
+		tableMongoDBField(ctx, d.Connection),
+	}
+	for _, table := range staticTables {
+		if _, ok := tables[table.Name]; ok {
+			plugin.Logger(ctx).Warn("mongodb.PluginTables", "msg", "static table overrides collection with the same name", "table", table.Name)
+		}
+		tables[table.Name] = table
+	}
 
 	plugin.Logger(ctx).Debug("mongodb.PluginTables.makeTables", "tables", tables)
 	return tables, nil
@@ -0,0 +1,253 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// schemaCacheVersion must be bumped whenever the format of the cache files, or the way that schemas are inferred,
+	// changes, so old files are ignored
+	schemaCacheVersion = 5
+	// schemaCacheCountTolerance is how much the number of documents of a collection can change (as a fraction of the
+	// count when the schema was inferred) before the cached schema is considered outdated
+	schemaCacheCountTolerance = 0.1
+	// schemaCacheCountSlack is the number of documents that can always be added or removed, so small collections don't
+	// invalidate their schemas on every insert
+	schemaCacheCountSlack = 100
+)
+
+// schemaCacheFile is the content of a cache file, there's one file per cached collection (or view)
+type schemaCacheFile struct {
+	Version int `json:"version"`
+	// Key is the [schemaCacheKey] of the entry, since the name of the file is only a hash of it
+	Key   string           `json:"key"`
+	Entry schemaCacheEntry `json:"entry"`
+}
+
+// schemaCacheEntry is the cached schema of a single collection (or view)
+type schemaCacheEntry struct {
+	// Schema is the [analyzer.StructType] that was inferred, encoded with [analyzer.MarshalType]
+	Schema    json.RawMessage `json:"schema"`
+	SampledAt time.Time       `json:"sampled_at"`
+	// Fingerprint covers everything that affects the inferred schema, apart from the documents themselves: the cluster,
+	// the sampling config, the pipeline of views, and the options of the collection (which include its validator)
+	Fingerprint string `json:"fingerprint"`
+	// DocumentCount is the (estimated) number of documents when the schema was inferred, or -1 if it's not known
+	DocumentCount int64 `json:"document_count"`
+	// Stats are the statistics of the documents that were sampled to infer the schema
+	Stats analyzer.Stats `json:"stats"`
+}
+
+/*
+schemaCache is the directory that holds the cached schemas of a connection. Each schema is stored on its own file, so
+caching a schema doesn't rewrite the others (which would write a quadratic amount of data when a connection with many
+collections starts up), and plugin processes that cache different collections at the same time don't overwrite each
+other's entries
+*/
+type schemaCache struct {
+	dir string
+}
+
+// getSchemaCache returns the schema cache for a connection, whose files are stored on a subdirectory of dir
+func getSchemaCache(dir, connectionName string) *schemaCache {
+	return &schemaCache{dir: filepath.Join(dir, connectionName)}
+}
+
+// entryPath is the file that holds the entry for key. Keys are hashed, since they contain the names of databases and
+// collections, which may contain characters that aren't valid in file names
+func (c *schemaCache) entryPath(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// get returns the cached schema for key, if there is one that is still valid. A missing or unreadable file is a miss
+func (c *schemaCache) get(ctx context.Context, key, fingerprint string, documentCount int64, ttl time.Duration) (analyzer.StructType, analyzer.Stats, bool) {
+	path := c.entryPath(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, analyzer.Stats{}, false
+	}
+	var file schemaCacheFile
+	if err == nil {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil || file.Version != schemaCacheVersion || file.Key != key {
+		plugin.Logger(ctx).Warn("mongodb.schemaCache", "msg", "ignoring unreadable or outdated cache file", "path", path, "err", err)
+		return nil, analyzer.Stats{}, false
+	}
+
+	entry := file.Entry
+	switch {
+	case time.Since(entry.SampledAt) > ttl:
+		plugin.Logger(ctx).Debug("mongodb.schemaCache", "msg", "expired", "key", key, "sampled_at", entry.SampledAt)
+		return nil, analyzer.Stats{}, false
+	case entry.Fingerprint != fingerprint:
+		plugin.Logger(ctx).Debug("mongodb.schemaCache", "msg", "collection options or sampling config changed", "key", key)
+		return nil, analyzer.Stats{}, false
+	case !documentCountIsClose(entry.DocumentCount, documentCount):
+		plugin.Logger(ctx).Debug("mongodb.schemaCache", "msg", "document count changed", "key", key, "cached", entry.DocumentCount, "current", documentCount)
+		return nil, analyzer.Stats{}, false
+	}
+
+	decoded, err := analyzer.UnmarshalType(entry.Schema)
+	if err != nil {
+		plugin.Logger(ctx).Warn("mongodb.schemaCache", "msg", "ignoring undecodable entry", "key", key, "err", err)
+		return nil, analyzer.Stats{}, false
+	}
+	typeMap, ok := decoded.(analyzer.StructType)
+	return typeMap, entry.Stats, ok
+}
+
+// set stores the schema (and the statistics it was inferred from) for key on its own file
+func (c *schemaCache) set(key, fingerprint string, documentCount int64, typeMap analyzer.StructType, stats analyzer.Stats) error {
+	encoded, err := analyzer.MarshalType(typeMap)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(schemaCacheFile{
+		Version: schemaCacheVersion,
+		Key:     key,
+		Entry: schemaCacheEntry{
+			Schema:        encoded,
+			SampledAt:     time.Now().UTC(),
+			Fingerprint:   fingerprint,
+			DocumentCount: documentCount,
+			Stats:         stats,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(c.entryPath(key), data)
+}
+
+// writeFileAtomically writes a file through a temporary file that is then renamed, so a crash (or another plugin
+// process) never sees a half-written file
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once it has been renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// documentCountIsClose reports whether the document count of a collection is close enough to the count when its schema
+// was cached, see [schemaCacheCountTolerance] and [schemaCacheCountSlack]. Unknown counts (-1) are always close, and
+// the count of a collection that was empty is only close if it's still empty
+func documentCountIsClose(cached, current int64) bool {
+	if cached < 0 || current < 0 {
+		return true
+	}
+	if cached == 0 {
+		return current == 0 // the schema of an empty collection is empty, so any document may add fields
+	}
+	allowed := math.Max(float64(cached)*schemaCacheCountTolerance, schemaCacheCountSlack)
+	return math.Abs(float64(current-cached)) <= allowed
+}
+
+// schemaCacheKey is the key of a collection (or a view that is declared on the config) on the cache of its connection
+func schemaCacheKey(ns namespace) string {
+	return strings.Join([]string{ns.Database, ns.Collection, ns.View}, "/")
+}
+
+/*
+schemaFingerprint hashes everything, apart from the documents themselves, that affects the schema of a collection. That
+includes the connection string, so a connection that is pointed to another cluster doesn't reuse the schemas of the
+previous one. Only a hash of it is used, since it may contain credentials (so changing those also invalidates the cache)
+*/
+func schemaFingerprint(ns namespace, connectionString string, sampleSize int, ignoreFields []string) (string, error) {
+	pipeline, err := bson.MarshalExtJSON(bson.D{{Key: "pipeline", Value: ns.Pipeline}}, true, false)
+	if err != nil {
+		return "", err
+	}
+	connectionHash := sha256.Sum256([]byte(connectionString))
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%x\x00%s\x00%s\x00%d\x00%s\x00%s", connectionHash, ns.Type, ns.OptionsHash, sampleSize, strings.Join(ignoreFields, "\x01"), pipeline)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/*
+getFieldTypesForCollectionCached is [getFieldTypesForCollection], but it reuses the schema that was inferred by a
+previous run of the plugin, if schema_cache_ttl is set and the cached schema is still valid. A cached schema stops being
+valid when it's older than the TTL, when the connection string, the options of the collection (e.g. its validator) or
+the sampling config change, or when the number of documents changes significantly. Errors while reading or writing the cache are logged
+and otherwise ignored, since the schema can always be inferred again
+*/
+func getFieldTypesForCollectionCached(ctx context.Context, connectionName string, cfg MongoDBConfig, coll *mongo.Collection, ns namespace, ignoreFields []string) (analyzer.StructType, analyzer.Stats, error) {
+	sampleSize := cfg.GetSampleSize()
+	infer := func() (analyzer.StructType, analyzer.Stats, error) {
+		return getFieldTypesForCollection(ctx, coll, ns.Pipeline, samplingStage(ns.Type, ns.Pipeline, sampleSize), ignoreFields)
+	}
+
+	ttl, err := cfg.GetSchemaCacheTTL()
+	if err != nil {
+		return nil, analyzer.Stats{}, err
+	}
+	if ttl == 0 {
+		return infer()
+	}
+	dir, err := cfg.GetSchemaCacheDir()
+	if err != nil {
+		return nil, analyzer.Stats{}, err
+	}
+	connectionString, err := cfg.GetConnectionString()
+	if err != nil {
+		return nil, analyzer.Stats{}, err
+	}
+	fingerprint, err := schemaFingerprint(ns, connectionString, sampleSize, ignoreFields)
+	if err != nil {
+		return nil, analyzer.Stats{}, err
+	}
+
+	// Views run their pipeline to be counted, which is as slow as sampling them, so they're only invalidated by the TTL
+	documentCount := int64(-1)
+	if ns.Type != collectionTypeView && len(ns.Pipeline) == 0 {
+		if count, err := coll.EstimatedDocumentCount(ctx); err == nil {
+			documentCount = count
+		} else {
+			plugin.Logger(ctx).Warn("mongodb.schemaCache", "msg", "couldn't count documents", "collection", coll.Name(), "err", err)
+		}
+	}
+
+	cache := getSchemaCache(dir, connectionName)
+	key := schemaCacheKey(ns)
+	if typeMap, stats, ok := cache.get(ctx, key, fingerprint, documentCount, ttl); ok {
+		plugin.Logger(ctx).Debug("mongodb.schemaCache", "msg", "hit", "key", key)
+		return typeMap, stats, nil
+	}
+
+	typeMap, stats, err := infer()
+	if err != nil {
+		return nil, analyzer.Stats{}, err
+	}
+	if err := cache.set(key, fingerprint, documentCount, typeMap, stats); err != nil {
+		plugin.Logger(ctx).Warn("mongodb.schemaCache", "msg", "couldn't write cache", "dir", cache.dir, "err", err)
+	}
+	return typeMap, stats, nil
+}
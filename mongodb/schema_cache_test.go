@@ -0,0 +1,155 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDocumentCountIsClose(t *testing.T) {
+	cases := []struct {
+		cached, current int64
+		expected        bool
+	}{
+		{1_000_000, 1_050_000, true},
+		{1_000_000, 1_200_000, false},
+		{1_000_000, 850_000, false},
+		{10, 90, true}, // within the slack
+		{10, 200, false},
+		{0, 0, true},
+		{0, 1, false},
+		{-1, 5_000, true},
+		{5_000, -1, true},
+	}
+	for _, tc := range cases {
+		if got := documentCountIsClose(tc.cached, tc.current); got != tc.expected {
+			t.Errorf("Expected documentCountIsClose(%d, %d) to be %v but it was %v", tc.cached, tc.current, tc.expected, got)
+		}
+	}
+}
+
+func TestSchemaCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	typeMap := analyzer.StructType{"_id": analyzer.PrimitiveObjectId, "tags": analyzer.SliceType{Type: analyzer.PrimitiveString}}
+	stats := analyzer.Stats{Documents: 2, Fields: map[string]analyzer.FieldStats{
+		"_id":  {Count: 2, Types: map[string]int{"objectId": 2}, Distinct: 2},
+		"tags": {Count: 1, Types: map[string]int{"array": 1}, Distinct: 1},
+	}}
+
+	cache := getSchemaCache(dir, "conn")
+	if err := cache.set("db/coll/", "fp", 1000, typeMap, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new cache on the same directory has to read it back from the file
+	reloaded := getSchemaCache(dir, "conn")
+	cached, cachedStats, ok := reloaded.get(ctx(), "db/coll/", "fp", 1010, time.Hour)
+	if !ok || !reflect.DeepEqual(cached, typeMap) {
+		t.Errorf("Expected to get %v from the cache but got %v (ok=%v)", typeMap, cached, ok)
+	}
+	if !reflect.DeepEqual(cachedStats, stats) {
+		t.Errorf("Expected to get stats %v from the cache but got %v", stats, cachedStats)
+	}
+
+	if _, _, ok := reloaded.get(ctx(), "db/other/", "fp", 1000, time.Hour); ok {
+		t.Errorf("Expected a miss for another collection")
+	}
+	if _, _, ok := reloaded.get(ctx(), "db/coll/", "other-fp", 1000, time.Hour); ok {
+		t.Errorf("Expected a miss when the fingerprint changes")
+	}
+	if _, _, ok := reloaded.get(ctx(), "db/coll/", "fp", 5000, time.Hour); ok {
+		t.Errorf("Expected a miss when the document count changes significantly")
+	}
+	if _, _, ok := reloaded.get(ctx(), "db/coll/", "fp", 1000, time.Nanosecond); ok {
+		t.Errorf("Expected a miss when the entry is older than the TTL")
+	}
+	if _, _, ok := getSchemaCache(dir, "other_conn").get(ctx(), "db/coll/", "fp", 1000, time.Hour); ok {
+		t.Errorf("Expected a miss for another connection")
+	}
+}
+
+func TestSchemaCacheKeepsOtherEntries(t *testing.T) {
+	dir := t.TempDir()
+	// Two plugin processes, that cache different collections of the same connection at the same time
+	first, second := getSchemaCache(dir, "conn"), getSchemaCache(dir, "conn")
+	if err := first.set("db/a/", "fp", -1, analyzer.StructType{"a": analyzer.PrimitiveString}, analyzer.Stats{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.set("db/b/", "fp", -1, analyzer.StructType{"b": analyzer.PrimitiveString}, analyzer.Stats{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]analyzer.StructType{
+		"db/a/": {"a": analyzer.PrimitiveString},
+		"db/b/": {"b": analyzer.PrimitiveString},
+	} {
+		if cached, _, ok := first.get(ctx(), key, "fp", -1, time.Hour); !ok || !reflect.DeepEqual(cached, expected) {
+			t.Errorf("Expected to get %v for %s but got %v (ok=%v)", expected, key, cached, ok)
+		}
+	}
+}
+
+func TestSchemaCacheIgnoresBadFiles(t *testing.T) {
+	for name, content := range map[string]string{
+		"garbage": "not json",
+		"version": `{"version": 999, "key": "db/coll/", "entry": {"schema": {"kind": "struct"}, "fingerprint": "fp", "document_count": -1}}`,
+		"key":     `{"version": 5, "key": "db/other/", "entry": {"schema": {"kind": "struct"}, "fingerprint": "fp", "document_count": -1}}`,
+	} {
+		cache := getSchemaCache(t.TempDir(), "conn")
+		path := cache.entryPath("db/coll/")
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, ok := cache.get(ctx(), "db/coll/", "fp", -1, time.Hour); ok {
+			t.Errorf("Expected a miss on %s", name)
+		}
+		// The cache must still be writable afterward
+		if err := cache.set("db/coll/", "fp", -1, analyzer.StructType{}, analyzer.Stats{}); err != nil {
+			t.Errorf("Unexpected error writing %s: %v", name, err)
+		}
+	}
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	ns := namespace{Database: "db", Collection: "coll", Type: collectionTypeCollection, OptionsHash: "abc"}
+	base, err := schemaFingerprint(ns, "mongodb://localhost", 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline, _ := parsePipeline(`[{"$match": {"a": 1}}]`)
+	changed := map[string]func() (string, error){
+		"sample size": func() (string, error) { return schemaFingerprint(ns, "mongodb://localhost", 500, nil) },
+		"ignored fields": func() (string, error) {
+			return schemaFingerprint(ns, "mongodb://localhost", 1000, []string{"a"})
+		},
+		"connection string": func() (string, error) {
+			return schemaFingerprint(ns, "mongodb://other-cluster", 1000, nil)
+		},
+		"options": func() (string, error) {
+			other := ns
+			other.OptionsHash = "def"
+			return schemaFingerprint(other, "mongodb://localhost", 1000, nil)
+		},
+		"pipeline": func() (string, error) {
+			other := ns
+			other.Pipeline = pipeline
+			return schemaFingerprint(other, "mongodb://localhost", 1000, nil)
+		},
+	}
+	for name, fingerprint := range changed {
+		other, err := fingerprint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other == base {
+			t.Errorf("Expected the fingerprint to change along with the %s", name)
+		}
+	}
+}
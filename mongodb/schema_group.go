@@ -0,0 +1,102 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+/*
+schemaGroup holds the types that have been inferred for every table by all the connections that share the same
+[MongoDBConfig.SchemaGroup]. This is used to support aggregator connections: Steampipe only merges the tables of the
+child connections of an aggregator if they have the same key columns, and since every column is a key column on
+dynamic tables, child connections that see slightly different data (e.g. a field that only exists on one cluster, or
+that is int32 on one and double on the other) would have their tables dropped from the aggregator.
+
+Instead, every connection in a group reports its own inferred types to the group, and builds its tables from the
+merge of the types of all connections, so all the connections end up exposing the same columns with the same types.
+*/
+type schemaGroup struct {
+	// members are the types that each connection inferred for each table, by table name and then connection name
+	members map[string]map[string]analyzer.StructType
+	// tables are the merged types of each table, i.e. the merge of its members
+	tables      map[string]analyzer.StructType
+	connections map[string]*plugin.Connection
+}
+
+var (
+	schemaGroups     = map[string]*schemaGroup{}
+	schemaGroupsLock sync.Mutex
+)
+
+/*
+reconcileSchemaGroup merges typeMap (inferred on a single connection) with the types that were inferred for the same
+table by every other connection in the same schema group, and returns the merged type, which should be used to build
+the table. typeMap is not modified.
+
+The merged type is rebuilt from the latest types of every connection each time, so it can also shrink, e.g. when a
+field is removed from the documents of every connection. If the merged type changed because of this connection (e.g.
+this connection saw a field that no other connection had seen before), all the other connections in the group are
+asked to rebuild their schemas, so they pick up the change.
+*/
+func reconcileSchemaGroup(ctx context.Context, groupName string, connection *plugin.Connection, tableName string, typeMap analyzer.StructType) analyzer.StructType {
+	schemaGroupsLock.Lock()
+	defer schemaGroupsLock.Unlock()
+
+	group, ok := schemaGroups[groupName]
+	if !ok {
+		group = &schemaGroup{
+			members:     map[string]map[string]analyzer.StructType{},
+			tables:      map[string]analyzer.StructType{},
+			connections: map[string]*plugin.Connection{},
+		}
+		schemaGroups[groupName] = group
+	}
+	group.connections[connection.Name] = connection
+
+	if group.members[tableName] == nil {
+		group.members[tableName] = map[string]analyzer.StructType{}
+	}
+	group.members[tableName][connection.Name] = analyzer.Copy(typeMap).(analyzer.StructType)
+
+	previous, ok := group.tables[tableName]
+	merged := mergeSchemaGroupMembers(group.members[tableName])
+	group.tables[tableName] = merged
+
+	if ok && !reflect.DeepEqual(previous, merged) {
+		plugin.Logger(ctx).Info("mongodb.reconcileSchemaGroup", "msg", "schema changed, reloading other connections", "group", groupName, "table", tableName)
+		for name, other := range group.connections {
+			if name == connection.Name {
+				continue
+			}
+			// This can't be done synchronously, since rebuilding the schema of the other connection will call
+			// reconcileSchemaGroup again, which needs the lock that we're holding now
+			go func(other *plugin.Connection) {
+				if err := pluginInstance.ConnectionSchemaChanged(other); err != nil {
+					plugin.Logger(ctx).Error("mongodb.reconcileSchemaGroup", "msg", "couldn't reload connection", "connection", other.Name, "err", err)
+				}
+			}(other)
+		}
+	}
+
+	return analyzer.Copy(merged).(analyzer.StructType)
+}
+
+// mergeSchemaGroupMembers merges the types that each connection inferred for a table. Connections are merged in order
+// of their names, so the result doesn't depend on the order in which they were loaded
+func mergeSchemaGroupMembers(members map[string]analyzer.StructType) analyzer.StructType {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	merged := analyzer.StructType{}
+	for _, name := range names {
+		merged = merged.Merge(analyzer.Copy(members[name]), nil).(analyzer.StructType)
+	}
+	return merged
+}
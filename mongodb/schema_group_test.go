@@ -0,0 +1,35 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"reflect"
+	"testing"
+)
+
+func TestMergeSchemaGroupMembers(t *testing.T) {
+	members := map[string]analyzer.StructType{
+		"eu": {"_id": analyzer.PrimitiveObjectId, "vat": analyzer.PrimitiveString},
+		"us": {"_id": analyzer.PrimitiveObjectId, "state": analyzer.PrimitiveString},
+	}
+	expected := analyzer.StructType{"_id": analyzer.PrimitiveObjectId, "vat": analyzer.PrimitiveString, "state": analyzer.PrimitiveString}
+	if merged := mergeSchemaGroupMembers(members); !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v but got %v", expected, merged)
+	}
+	if _, ok := members["eu"]["state"]; ok {
+		t.Errorf("Expected the members to be left as they were, but got %v", members["eu"])
+	}
+}
+
+func TestReconcileSchemaGroupDropsRemovedFields(t *testing.T) {
+	connection := &plugin.Connection{Name: "test_schema_group"}
+	defer delete(schemaGroups, "test_schema_group")
+
+	reconcileSchemaGroup(ctx(), "test_schema_group", connection, "orders", analyzer.StructType{"a": analyzer.PrimitiveString, "b": analyzer.PrimitiveInt32})
+	// b was removed from every document (of the only connection in the group), so it must not be kept around
+	merged := reconcileSchemaGroup(ctx(), "test_schema_group", connection, "orders", analyzer.StructType{"a": analyzer.PrimitiveString})
+	expected := analyzer.StructType{"a": analyzer.PrimitiveString}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Expected %v but got %v", expected, merged)
+	}
+}
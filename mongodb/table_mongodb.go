@@ -1,6 +1,7 @@
 package mongodb
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
@@ -8,77 +9,378 @@ import (
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"strings"
 )
 
-func tableMongoDB(ctx context.Context, connection *plugin.Connection) (*plugin.Table, error) {
-	collName := ctx.Value(keyCollection).(string)
+func tableMongoDB(ctx context.Context, client *mongo.Client, connection *plugin.Connection) (*plugin.Table, error) {
+	ns := ctx.Value(keyNamespace).(namespace)
+	collName, dbName := ns.Collection, ns.Database
 	cfg := GetConfig(connection)
-	dbName := cfg.Database
 
-	client, err := connect(ctx, *cfg.ConnectionString)
-	if err != nil {
-		return nil, err
-	}
 	coll := client.Database(dbName).Collection(collName)
 
-	typeMap, err := getFieldTypesForCollection(ctx, coll, cfg.GetSampleSize(), cfg.GetFieldsToIgnore(collName))
+	tableName := cfg.GetTableName(dbName, collName)
+	description := fmt.Sprintf("Collection %s on database %s", collName, dbName)
+	switch ns.Type {
+	case collectionTypeView:
+		description = fmt.Sprintf("View %s on database %s", collName, dbName)
+	case collectionTypeTimeSeries:
+		description = fmt.Sprintf("Time series collection %s on database %s", collName, dbName)
+	}
+	ignoreFields := cfg.GetFieldsToIgnore(collName)
+	schemaConfig := cfg.GetCollectionSchema(dbName, collName)
+	if ns.View != "" {
+		tableName = ns.View
+		description = fmt.Sprintf("View %s over collection %s on database %s", ns.View, collName, dbName)
+		ignoreFields = cfg.GetFieldsToIgnore(ns.View) // the fields of a view are those output by its pipeline
+		schemaConfig = cfg.GetCollectionSchema(dbName, ns.View)
+	}
+	if ns.Unwind != "" {
+		description = fmt.Sprintf("Elements of the %s array of collection %s on database %s", ns.Unwind, collName, dbName)
+	}
+
+	var declared *declaredSchema
+	if schemaConfig != nil {
+		var err error
+		if declared, err = getDeclaredSchema(schemaConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	var typeMap analyzer.StructType
+	var stats analyzer.Stats // stays empty if the collection isn't sampled
+	if declared != nil && declared.Precedence == schemaPrecedenceOnly {
+		// The collection isn't sampled at all, so this also works for collections that are too large to sample
+		typeMap = mergeDeclaredSchema(nil, declared)
+	} else if ns.Unwind != "" {
+		// Child tables reuse the element type that was merged while sampling their parent, see [childElementType]
+		typeMap = ns.ElementType
+		if declared != nil {
+			typeMap = mergeDeclaredSchema(typeMap, declared)
+		}
+	} else {
+		inferred, inferredStats, err := getFieldTypesForCollectionCached(ctx, connection.Name, cfg, coll, ns, ignoreFields)
+		if err != nil {
+			return nil, err
+		}
+		stats = inferredStats
+		if ns.TimeField != "" {
+			// The time field of a time series collection is always a date, so don't leave it up to sampling
+			inferred[ns.TimeField] = analyzer.PrimitiveDateTime
+		}
+		typeMap = inferred
+		if declared != nil {
+			typeMap = mergeDeclaredSchema(inferred, declared)
+		}
+	}
+	var paths columnPaths
+	if declared != nil {
+		paths = declared.Paths
+	}
+	if cfg.SchemaGroup != nil && *cfg.SchemaGroup != "" {
+		// Use the same types as all other connections in the group, so Steampipe can aggregate them
+		typeMap = reconcileSchemaGroup(ctx, *cfg.SchemaGroup, connection, tableName, typeMap)
+	}
+	if encoded, err := analyzer.MarshalType(typeMap); err == nil {
+		// To see what was inferred for each collection, run with STEAMPIPE_LOG_LEVEL=debug
+		plugin.Logger(ctx).Debug("mongodb.tableMongoDB", "table", tableName, "schema", string(encoded))
+	}
+	colTypes, err := convertMongoTypeToColumnTypes(ctx, typeMap)
 	if err != nil {
 		return nil, err
 	}
-	colTypes, err := convertMongoTypeToColumnTypes(ctx, typeMap)
+
+	strategy, err := cfg.GetMixedTypeStrategy()
 	if err != nil {
 		return nil, err
 	}
+	if strategy == mixedTypeMajority && cfg.SchemaGroup != nil && *cfg.SchemaGroup != "" {
+		// The majority may differ between the connections of the group, widening gives them all the same types
+		plugin.Logger(ctx).Info("mongodb.tableMongoDB", "msg", "using the widen mixed_type_strategy, since majority can't be used with schema_group", "table", tableName)
+		strategy = mixedTypeWiden
+	}
+	resolvedTypes := map[string]proto.ColumnType{} // only the columns whose values must be coerced
+	for path, colType := range colTypes {
+		if colType != proto.ColumnType_JSON {
+			continue // only fields with several types become JSONB columns
+		}
+		t, err := typeMap.GetTypeOfChild(path)
+		if err != nil {
+			return nil, err
+		}
+		var field *analyzer.FieldStats
+		if fieldStats, ok := stats.Fields[path]; ok {
+			field = &fieldStats
+		}
+		if resolved, coerce := resolveColumnType(ctx, t, strategy, field); coerce {
+			colTypes[path] = resolved
+			resolvedTypes[path] = resolved
+		}
+	}
+	registerTableSchema(connection.Name, tableName, tableSchema{Namespace: ns, TypeMap: typeMap, Stats: stats, Paths: paths, IgnoreFields: ignoreFields, ColumnTypes: resolvedTypes})
+
+	// Columns must be generated in a stable order, since Steampipe compares the key columns of tables positionally when
+	// building aggregator connections
+	colNames := make([]string, 0, len(colTypes))
+	for colName := range colTypes {
+		colNames = append(colNames, colName)
+	}
+	slices.Sort(colNames)
+
+	var indexes indexedFields
+	if len(ns.Pipeline) == 0 && ns.Type != collectionTypeView {
+		// Views (both those on MongoDB and those declared in the config) have no indexes of their own
+		if indexes, err = getIndexedFields(ctx, coll); err != nil {
+			// Not fatal, the table can still be listed, but nothing will be known about its indexes
+			plugin.Logger(ctx).Warn("mongodb.tableMongoDB", "msg", "couldn't list indexes", "collection", collName, "err", err)
+		}
+	}
+	requireIndexed := cfg.RequireIndexedFilter && len(ns.Pipeline) == 0 && ns.Type != collectionTypeView
 
 	cols := []*plugin.Column{}
 	quals := make([]*plugin.KeyColumn, 0, len(cols))
-	for colName, colType := range colTypes {
+	for _, path := range colNames {
+		colType := colTypes[path]
 		if colType == proto.ColumnType_UNKNOWN {
-			plugin.Logger(ctx).Warn("Column would be unknown, ignoring instead", "column", colName)
+			plugin.Logger(ctx).Warn("Column would be unknown, ignoring instead", "column", path)
 			continue // these columns can't be presented to Steampipe
 		}
+		if _, ok := paths[path]; ok {
+			plugin.Logger(ctx).Warn("Field is hidden by a declared column with the same name, ignoring", "column", path)
+			continue
+		}
 
+		// Declared columns may be named differently from the field that backs them, everything else is named by path
+		colName := paths.name(path)
+		colTransform := transform.FromP(FromSingleField, path).Transform(mongoTransformFunction)
+		if _, ok := resolvedTypes[path]; ok {
+			colTransform = colTransform.TransformP(coerceToColumnType, colType)
+		}
 		cols = append(cols, &plugin.Column{
 			Name:        colName,
 			Type:        colType,
-			Transform:   transform.FromP(FromSingleField, colName).Transform(mongoTransformFunction),
-			Description: fmt.Sprintf("Field %s", colName),
+			Transform:   colTransform,
+			Description: columnDescription(ns, path, stats),
 		})
-		quals = append(quals, qualsForColumnOfType(colName, colType))
+		keyColumn := qualsForColumnOfType(colName, colType)
+		if requireIndexed && slices.Contains(indexes.Indexed, path) {
+			keyColumn.Require = plugin.AnyOf // so Steampipe rejects queries without any of them before calling us
+		}
+		quals = append(quals, keyColumn)
 	}
 
-	return &plugin.Table{
-		Name:        collName,
-		Description: fmt.Sprintf("Collection %s on database %s", coll.Name(), coll.Database().Name()),
+	table := &plugin.Table{
+		Name:        tableName,
+		Description: description,
 		List: &plugin.ListConfig{
-			Hydrate:    listMongoDBWithName(collName, typeMap),
+			Hydrate:    listMongoDBWithName(dbName, collName, ns.Pipeline, ns.Unwind != "", typeMap, paths, indexes.Indexed, requireIndexed),
 			KeyColumns: quals,
 		},
 		Columns: cols,
-	}, nil
+	}
+	if getFields := getColumnsForCollection(ns, indexes.Unique, paths.columns(cols), typeMap); len(getFields) > 0 {
+		getColumns := make([]string, len(getFields))
+		for i, field := range getFields {
+			getColumns[i] = paths.name(field)
+		}
+		table.Get = &plugin.GetConfig{
+			Hydrate:    getMongoDBWithName(dbName, collName, getColumns, typeMap, paths),
+			KeyColumns: plugin.AnyColumn(getColumns),
+		}
+	}
+	return table, nil
 }
 
-func listMongoDBWithName(collName string, typeMap analyzer.StructType) func(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
-	var _ = 1
+/*
+getColumnsForCollection returns the columns that can be used to Get a single document, i.e. those in uniqueFields (see
+[getIndexedFields]). Only plain collections qualify: views and the views that are declared in the config have no indexes
+(and their output may not be unique), and time series collections have no unique indexes. Columns are left out if
+they're JSONB (their values can't be converted back to BSON) or if they came from BSON Timestamps (equality on them is
+a range, see [timestampFilter])
+*/
+func getColumnsForCollection(ns namespace, uniqueFields []string, cols []*plugin.Column, typeMap analyzer.StructType) []string {
+	if ns.Type != collectionTypeCollection || len(ns.Pipeline) > 0 {
+		return nil
+	}
+
+	var getColumns []string
+	for _, field := range uniqueFields {
+		colIndex := slices.IndexFunc(cols, func(c *plugin.Column) bool { return c.Name == field })
+		if colIndex < 0 || cols[colIndex].Type == proto.ColumnType_JSON {
+			continue
+		}
+		mongoType, err := typeMap.GetTypeOfChild(field)
+		if err != nil {
+			continue
+		}
+		if mixed, ok := mongoType.(analyzer.MixedType); ok {
+			mongoType = mixed.GetNonNilType()
+		}
+		if _, ok := mongoType.(analyzer.MixedType); ok || mongoType == analyzer.PrimitiveTimestamp {
+			continue
+		}
+		getColumns = append(getColumns, field)
+	}
+	return getColumns
+}
+
+// getMongoDBWithName builds the get hydrate for a table, which reads the single document that matches the first of
+// getColumns that has a qual. Concurrent calls are batched, see [getBatcher]
+func getMongoDBWithName(dbName, collName string, getColumns []string, typeMap analyzer.StructType, paths columnPaths) func(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
 	return func(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
-		quals := d.Quals
-		plugin.Logger(ctx).Info("listMongoDB", "quals", quals)
+		for _, colName := range getColumns {
+			qual, ok := d.EqualsQuals[colName]
+			if !ok || qual == nil {
+				continue
+			}
+			colIndex := slices.IndexFunc(d.Table.Columns, func(c *plugin.Column) bool { return c.Name == colName })
+			field := paths.path(colName)
+			mongoType, err := typeMap.GetTypeOfChild(field)
+			if err != nil || colIndex < 0 {
+				return nil, err
+			}
+			value, err := qualValueToMongo(qual, d.Table.Columns[colIndex].Type, mongoType)
+			if err != nil {
+				// e.g. WHERE _id='not-an-objectid', which can't match anything
+				plugin.Logger(ctx).Debug("getMongoDB", "msg", "value can't match any document", "column", colName, "err", err)
+				return nil, nil
+			}
+
+			client, err := getClientForQuery(ctx, d)
+			if err != nil {
+				return nil, err
+			}
+			coll := client.Database(dbName).Collection(collName)
+			doc, err := getBatches.get(ctx, d.Connection.Name, coll, field, value)
+			if err != nil || doc == nil {
+				return nil, err // returning a typed nil bson.M would be a row
+			}
+			return doc, nil
+		}
+		return nil, nil
+	}
+}
 
-		client, err := connect(ctx, *GetConfig(d.Connection).ConnectionString)
+/*
+columnDescription returns the description of the column for the field at path, e.g. "Field email (string, 98.2%
+present)", with the types and presence that were observed while sampling (if it was sampled), and calling out the
+special fields of time series collections
+*/
+func columnDescription(ns namespace, path string, stats analyzer.Stats) string {
+	var details []string
+	if summary := fieldSummary(stats, path); summary != "" {
+		details = append(details, summary)
+	}
+	switch {
+	case ns.TimeField != "" && path == ns.TimeField:
+		details = append(details, "time field of the time series collection")
+	case ns.MetaField != "" && (path == ns.MetaField || strings.HasPrefix(path, ns.MetaField+".")):
+		details = append(details, "metadata of the time series collection")
+	case ns.Unwind != "" && path == childParentIDColumn:
+		details = append(details, fmt.Sprintf("_id of the document that contains the %s array", ns.Unwind))
+	case ns.Unwind != "" && path == childIndexColumn:
+		details = append(details, fmt.Sprintf("position on the %s array, starting from 0", ns.Unwind))
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("Field %s", path)
+	}
+	return fmt.Sprintf("Field %s (%s)", path, strings.Join(details, ", "))
+}
+
+// fieldSummary describes the types of a field and how often it was present, e.g. "string|int32, 98.2% present", or
+// returns "" if the field wasn't seen while sampling
+func fieldSummary(stats analyzer.Stats, path string) string {
+	field, ok := stats.Fields[path]
+	if !ok || stats.Documents == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s, %.1f%% present", fieldTypes(field), stats.Presence(path)*100)
+}
+
+// fieldTypes returns the types that a field had, most common first and ignoring nulls (unless it was always null)
+func fieldTypes(field analyzer.FieldStats) string {
+	return strings.Join(sortedFieldTypes(field), "|")
+}
+
+// sortedFieldTypes returns the names of the types that a field had, as described in [fieldTypes]
+func sortedFieldTypes(field analyzer.FieldStats) []string {
+	types := make([]string, 0, len(field.Types))
+	for name := range field.Types {
+		if name != "null" || len(field.Types) == 1 {
+			types = append(types, name)
+		}
+	}
+	slices.SortFunc(types, func(a, b string) int {
+		if c := cmp.Compare(field.Types[b], field.Types[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return types
+}
+
+/*
+listMongoDBWithName builds the list hydrate for a table. If pipeline isn't empty, the table is a view, so the documents
+are read by running that pipeline instead of reading the collection directly, and the quals apply to its output.
+unwound is true for child tables, whose quals on the parent _id are applied before the pipeline (see [splitParentFilter]).
+
+paths maps the declared columns that are named differently from their fields to those fields (see [columnPaths]).
+indexed are the fields that have an index. Queries that can't use any of them scan the whole collection, which is
+logged, or rejected if requireIndexed is true (see [MongoDBConfig.RequireIndexedFilter])
+*/
+func listMongoDBWithName(dbName, collName string, pipeline mongo.Pipeline, unwound bool, typeMap analyzer.StructType, paths columnPaths, indexed []string, requireIndexed bool) func(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	return func(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+		plugin.Logger(ctx).Info("listMongoDB", "quals", d.Quals)
+		// From here on, columns are referred to by the paths of their fields
+		quals := paths.quals(d.Quals)
+		tableColumns := paths.columns(d.Table.Columns)
+
+		if len(pipeline) == 0 && !qualsUseIndex(quals, indexed) {
+			if requireIndexed {
+				return nil, fmt.Errorf("queries on %s.%s must filter on an indexed field (one of %s), since require_indexed_filter is enabled. Equality, ranges and prefix matches such as LIKE 'abc%%' can use an index", dbName, collName, strings.Join(indexed, ", "))
+			}
+			plugin.Logger(ctx).Warn("listMongoDB", "msg", "no filter can use an index, the entire collection will be scanned", "database", dbName, "collection", collName, "indexed", indexed)
+		}
+
+		client, err := getClientForQuery(ctx, d)
 		if err != nil {
 			return nil, err
 		}
-		dbName := GetConfig(d.Connection).Database
 
 		coll := client.Database(dbName).Collection(collName)
-		filter := qualsToMongoFilter(ctx, quals, d.Table.Columns, typeMap)
-		opts := options.Find()
-		if d.QueryContext.Limit != nil {
-			opts.SetLimit(*d.QueryContext.Limit)
+		filter, complete := qualsToMongoFilter(ctx, quals, tableColumns, typeMap)
+		limit := pushedLimit(d.QueryContext.Limit, complete)
+		projection := columnsToProjection(paths.paths(d.QueryContext.Columns), tableColumns)
+
+		var cursor *mongo.Cursor
+		if len(pipeline) > 0 {
+			viewPipeline := slices.Clone(pipeline)
+			if unwound {
+				var parentFilter bson.D
+				if parentFilter, filter = splitParentFilter(filter); len(parentFilter) > 0 {
+					viewPipeline = slices.Insert(viewPipeline, 0, bson.D{{Key: "$match", Value: parentFilter}})
+				}
+			}
+			if len(filter) > 0 {
+				viewPipeline = append(viewPipeline, bson.D{{Key: "$match", Value: filter}})
+			}
+			if limit != nil {
+				viewPipeline = append(viewPipeline, bson.D{{Key: "$limit", Value: *limit}})
+			}
+			viewPipeline = append(viewPipeline, bson.D{{Key: "$project", Value: projection}})
+			plugin.Logger(ctx).Info("listMongoDB", "database", dbName, "collection", collName, "pipeline", viewPipeline)
+			cursor, err = coll.Aggregate(ctx, viewPipeline)
+		} else {
+			opts := options.Find().SetProjection(projection)
+			if limit != nil {
+				opts.SetLimit(*limit)
+			}
+			plugin.Logger(ctx).Info("listMongoDB", "database", dbName, "collection", collName, "filter", filter, "projection", projection, "limit", opts.Limit)
+			cursor, err = coll.Find(ctx, filter, opts)
 		}
-		plugin.Logger(ctx).Info("listMongoDB", "database", dbName, "collection", collName, "filter", filter, "limit", opts.Limit)
-		cursor, err := coll.Find(ctx, filter, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -95,3 +397,16 @@ func listMongoDBWithName(collName string, typeMap analyzer.StructType) func(ctx
 		return nil, nil
 	}
 }
+
+/*
+pushedLimit returns the LIMIT of the query if it can be sent to MongoDB, or nil otherwise. Steampipe only passes the
+LIMIT if all quals are on key columns, but MongoDB may still return documents that Postgres then filters out if some of
+those quals weren't translated (i.e. filterComplete is false, see [qualsToMongoFilter]), so the LIMIT would return fewer
+rows than it should
+*/
+func pushedLimit(limit *int64, filterComplete bool) *int64 {
+	if !filterComplete {
+		return nil
+	}
+	return limit
+}
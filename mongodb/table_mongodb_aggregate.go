@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// aggregateRow is a row of the mongodb_aggregate table. The pipeline column is just an echo of the qual
+type aggregateRow struct {
+	Database   string
+	Collection string
+	Result     any
+}
+
+func tableMongoDBAggregate(_ context.Context, _ *plugin.Connection) *plugin.Table {
+	return &plugin.Table{
+		Name:        "mongodb_aggregate",
+		Description: "Run an arbitrary aggregation pipeline, expressed as MongoDB Extended JSON, on any collection",
+		List: &plugin.ListConfig{
+			Hydrate: listMongoDBAggregate,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "collection", Require: plugin.Required},
+				{Name: "pipeline", Require: plugin.Required},
+				{Name: "database", Require: plugin.Optional},
+			},
+		},
+		Columns: []*plugin.Column{
+			{Name: "database", Type: proto.ColumnType_STRING, Transform: transform.FromField("Database"), Description: "The database that contains the collection. Can be omitted if the connection only exposes one database."},
+			{Name: "collection", Type: proto.ColumnType_STRING, Transform: transform.FromField("Collection"), Description: "The collection that the pipeline runs on."},
+			{Name: "pipeline", Type: proto.ColumnType_JSON, Transform: transform.FromQual("pipeline").Transform(parseJSONQual), Description: "The aggregation pipeline, as a JSON array of stages, e.g. [{\"$group\": {\"_id\": \"$status\", \"n\": {\"$sum\": 1}}}]."},
+			{Name: "result", Type: proto.ColumnType_JSON, Transform: transform.FromField("Result"), Description: "A document that is output by the pipeline, in relaxed Extended JSON format. Use result->>'field' to read its fields."},
+		},
+	}
+}
+
+func listMongoDBAggregate(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+	database, err := getSingleDatabaseForQuery(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getClientForQuery(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	collection := d.EqualsQualString("collection")
+
+	pipeline, err := parsePipeline(jsonQualString(d.EqualsQuals["pipeline"]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %w", err)
+	}
+	if d.QueryContext.Limit != nil {
+		// LIMIT applies to the output of the pipeline, so it can always be added as the very last stage
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: *d.QueryContext.Limit}})
+	}
+
+	plugin.Logger(ctx).Info("listMongoDBAggregate", "database", database, "collection", collection, "pipeline", pipeline)
+	cursor, err := client.Database(database).Collection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) && d.RowsRemaining(ctx) > 0 {
+		result, err := bsonToJSON(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		d.StreamListItem(ctx, aggregateRow{Database: database, Collection: collection, Result: result})
+	}
+	return nil, cursor.Err()
+}
@@ -0,0 +1,156 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collectionRow is a row of the mongodb_collection table, built from the output of listCollections
+type collectionRow struct {
+	Database  string
+	Name      string
+	Type      string
+	ReadOnly  bool
+	Capped    bool
+	Options   any
+	Validator any
+}
+
+// collectionStats is the relevant subset of the storageStats that are returned by $collStats, summed across all
+// shards if the collection is sharded
+// See https://www.mongodb.com/docs/manual/reference/operator/aggregation/collStats/#storagestats-document
+type collectionStats struct {
+	Count          int64            `bson:"count"`
+	Size           int64            `bson:"size,truncate"`
+	AvgObjSize     float64          `bson:"avgObjSize"`
+	StorageSize    int64            `bson:"storageSize,truncate"`
+	Nindexes       int64            `bson:"nindexes"`
+	TotalIndexSize int64            `bson:"totalIndexSize,truncate"`
+	IndexSizes     map[string]int64 `bson:"indexSizes"`
+}
+
+func tableMongoDBCollection(_ context.Context, _ *plugin.Connection) *plugin.Table {
+	return &plugin.Table{
+		Name:             "mongodb_collection",
+		Description:      "Collections, views and time series collections on the databases that are exposed by this connection",
+		DefaultTransform: transform.FromGo(),
+		List: &plugin.ListConfig{
+			Hydrate: listMongoDBCollections,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "database", Require: plugin.Optional},
+				{Name: "name", Require: plugin.Optional},
+			},
+		},
+		HydrateConfig: []plugin.HydrateConfig{
+			{Func: getMongoDBCollectionStats},
+		},
+		Columns: []*plugin.Column{
+			{Name: "database", Type: proto.ColumnType_STRING, Description: "The name of the database that contains the collection."},
+			{Name: "name", Type: proto.ColumnType_STRING, Description: "The name of the collection."},
+			{Name: "type", Type: proto.ColumnType_STRING, Description: "The type of the collection, one of collection, view or timeseries."},
+			{Name: "read_only", Type: proto.ColumnType_BOOL, Description: "True if the collection is read-only (e.g. views)."},
+			{Name: "capped", Type: proto.ColumnType_BOOL, Description: "True if the collection is a capped collection."},
+			{Name: "options", Type: proto.ColumnType_JSON, Description: "The options that were used to create the collection, such as the pipeline of a view."},
+			{Name: "validator", Type: proto.ColumnType_JSON, Description: "The schema validation rules of the collection, if any."},
+			{Name: "document_count", Type: proto.ColumnType_INT, Hydrate: getMongoDBCollectionStats, Transform: transform.FromField("Count"), Description: "The number of documents in the collection. Not available for views."},
+			{Name: "size", Type: proto.ColumnType_INT, Hydrate: getMongoDBCollectionStats, Description: "The total uncompressed size of the documents in the collection, in bytes. Not available for views."},
+			{Name: "avg_obj_size", Type: proto.ColumnType_DOUBLE, Hydrate: getMongoDBCollectionStats, Description: "The average size of each document, in bytes. Not available for views."},
+			{Name: "storage_size", Type: proto.ColumnType_INT, Hydrate: getMongoDBCollectionStats, Description: "The amount of storage allocated to the collection, in bytes. Not available for views."},
+			{Name: "index_count", Type: proto.ColumnType_INT, Hydrate: getMongoDBCollectionStats, Transform: transform.FromField("Nindexes"), Description: "The number of indexes on the collection. Not available for views."},
+			{Name: "total_index_size", Type: proto.ColumnType_INT, Hydrate: getMongoDBCollectionStats, Description: "The total size of all the indexes on the collection, in bytes. Not available for views."},
+		},
+	}
+}
+
+func listMongoDBCollections(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+	client, databases, err := getDatabasesForQuery(ctx, d, "database")
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{}
+	if qual, ok := d.EqualsQuals["name"]; ok {
+		filter = bson.D{{Key: "name", Value: qual.GetStringValue()}}
+	}
+
+	for _, database := range databases {
+		specs, err := client.Database(database).ListCollectionSpecifications(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			row := collectionRow{Database: database, Name: spec.Name, Type: spec.Type, ReadOnly: spec.ReadOnly}
+			if len(spec.Options) > 0 {
+				if row.Options, err = bsonToJSON(spec.Options); err != nil {
+					return nil, err
+				}
+			}
+			if validator, err := spec.Options.LookupErr("validator"); err == nil {
+				if row.Validator, err = bsonToJSON(validator); err != nil {
+					return nil, err
+				}
+			}
+			if capped, ok := spec.Options.Lookup("capped").BooleanOK(); ok {
+				row.Capped = capped
+			}
+
+			d.StreamListItem(ctx, row)
+			if d.RowsRemaining(ctx) == 0 {
+				return nil, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func getMongoDBCollectionStats(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	row := h.Item.(collectionRow)
+	if row.Type == "view" {
+		return nil, nil // views don't have storage of their own
+	}
+
+	client, err := getClientForQuery(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return getCollectionStats(ctx, client.Database(row.Database).Collection(row.Name))
+}
+
+// getCollectionStats runs $collStats on a collection and returns its storage stats, summed across all shards
+func getCollectionStats(ctx context.Context, coll *mongo.Collection) (*collectionStats, error) {
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.M{"storageStats": bson.M{}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	total := &collectionStats{IndexSizes: map[string]int64{}}
+	for cursor.Next(ctx) {
+		var result struct {
+			StorageStats collectionStats `bson:"storageStats"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		// There's one result per shard, so add them all up
+		stats := result.StorageStats
+		total.Count += stats.Count
+		total.Size += stats.Size
+		total.StorageSize += stats.StorageSize
+		total.Nindexes = stats.Nindexes // every shard has the same indexes
+		total.TotalIndexSize += stats.TotalIndexSize
+		for name, size := range stats.IndexSizes {
+			total.IndexSizes[name] += size
+		}
+	}
+	if total.Count > 0 {
+		total.AvgObjSize = float64(total.Size) / float64(total.Count)
+	}
+	return total, cursor.Err()
+}
@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// databaseRow is a row of the mongodb_database table, as returned by listDatabases
+type databaseRow struct {
+	Name       string
+	SizeOnDisk *int64
+	Empty      *bool
+}
+
+// databaseStats is the relevant subset of the response of the dbStats command
+// See https://www.mongodb.com/docs/manual/reference/command/dbStats/#output
+type databaseStats struct {
+	Collections int64   `bson:"collections"`
+	Views       int64   `bson:"views"`
+	Objects     int64   `bson:"objects"`
+	AvgObjSize  float64 `bson:"avgObjSize"`
+	DataSize    int64   `bson:"dataSize,truncate"`
+	StorageSize int64   `bson:"storageSize,truncate"`
+	Indexes     int64   `bson:"indexes"`
+	IndexSize   int64   `bson:"indexSize,truncate"`
+	TotalSize   int64   `bson:"totalSize,truncate"`
+}
+
+func tableMongoDBDatabase(_ context.Context, _ *plugin.Connection) *plugin.Table {
+	return &plugin.Table{
+		Name:        "mongodb_database",
+		Description: "Databases that are exposed by this connection, with their storage statistics",
+		// Zero is a meaningful value for most columns here (e.g. a database with 0 views), so don't apply NullIfZero
+		DefaultTransform: transform.FromGo(),
+		List: &plugin.ListConfig{
+			Hydrate: listMongoDBDatabases,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "name", Require: plugin.Optional},
+			},
+		},
+		HydrateConfig: []plugin.HydrateConfig{
+			{Func: getMongoDBDatabaseStats},
+		},
+		Columns: []*plugin.Column{
+			{Name: "name", Type: proto.ColumnType_STRING, Description: "The name of the database."},
+			{Name: "size_on_disk", Type: proto.ColumnType_INT, Description: "The total size of the database files on disk, in bytes. Only available if the user can run listDatabases."},
+			{Name: "empty", Type: proto.ColumnType_BOOL, Description: "True if the database has no data. Only available if the user can run listDatabases."},
+			{Name: "collections", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The number of collections in the database."},
+			{Name: "views", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The number of views in the database."},
+			{Name: "objects", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The number of documents in the database, across all collections."},
+			{Name: "avg_obj_size", Type: proto.ColumnType_DOUBLE, Hydrate: getMongoDBDatabaseStats, Description: "The average size of each document, in bytes."},
+			{Name: "data_size", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The total size of the uncompressed data held in the database, in bytes."},
+			{Name: "storage_size", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The total amount of space allocated to collections in the database, in bytes."},
+			{Name: "indexes", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The total number of indexes across all collections in the database."},
+			{Name: "index_size", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The total amount of space allocated to indexes in the database, in bytes."},
+			{Name: "total_size", Type: proto.ColumnType_INT, Hydrate: getMongoDBDatabaseStats, Description: "The sum of storage_size and index_size, in bytes."},
+		},
+	}
+}
+
+func listMongoDBDatabases(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+	client, databases, err := getDatabasesForQuery(ctx, d, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	// listDatabases requires extra privileges, so its data is optional. If it fails, the rows are still returned
+	// (since the database names come from the config), just with fewer columns
+	specs := map[string]databaseRow{}
+	result, err := client.ListDatabases(ctx, bson.D{}, options.ListDatabases().SetAuthorizedDatabases(true))
+	if err != nil {
+		plugin.Logger(ctx).Warn("mongodb.listMongoDBDatabases", "msg", "couldn't list databases", "err", err)
+	} else {
+		for _, spec := range result.Databases {
+			spec := spec
+			specs[spec.Name] = databaseRow{Name: spec.Name, SizeOnDisk: &spec.SizeOnDisk, Empty: &spec.Empty}
+		}
+	}
+
+	for _, database := range databases {
+		row, ok := specs[database]
+		if !ok {
+			row = databaseRow{Name: database}
+		}
+		d.StreamListItem(ctx, row)
+		if d.RowsRemaining(ctx) == 0 {
+			break
+		}
+	}
+	return nil, nil
+}
+
+func getMongoDBDatabaseStats(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	database := h.Item.(databaseRow).Name
+	client, err := getClientForQuery(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats databaseStats
+	if err := client.Database(database).RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,106 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"slices"
+)
+
+// fieldRow is a row of the mongodb_field table
+type fieldRow struct {
+	TableName  string
+	Database   string
+	Collection string
+	Field      string
+	ColumnName *string
+	ColumnType *string
+	// Type is the summary of the types of the field, most common first, see [fieldTypes]
+	Type          string
+	Types         map[string]int
+	Documents     int
+	PresentCount  int
+	PresentRatio  float64
+	NullCount     int
+	DistinctCount int
+}
+
+func tableMongoDBField(_ context.Context, _ *plugin.Connection) *plugin.Table {
+	return &plugin.Table{
+		Name:             "mongodb_field",
+		Description:      "Fields of the documents that were sampled to build each collection table, with how often each field and each type appeared",
+		DefaultTransform: transform.FromGo(),
+		List: &plugin.ListConfig{
+			Hydrate: listMongoDBFields,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "table_name", Require: plugin.Optional},
+			},
+		},
+		Columns: []*plugin.Column{
+			{Name: "table_name", Type: proto.ColumnType_STRING, Description: "The name of the table."},
+			{Name: "database", Type: proto.ColumnType_STRING, Description: "The name of the database that contains the collection."},
+			{Name: "collection", Type: proto.ColumnType_STRING, Description: "The name of the collection that backs the table."},
+			{Name: "field", Type: proto.ColumnType_STRING, Description: "The path of the field, e.g. customer.name."},
+			{Name: "column_name", Type: proto.ColumnType_STRING, Description: "The column of the table that the field is exposed as. Null for documents that were exploded into a column per field."},
+			{Name: "column_type", Type: proto.ColumnType_STRING, Description: "The Steampipe type of the column, e.g. STRING, INT or JSON."},
+			{Name: "type", Type: proto.ColumnType_STRING, Description: "The BSON types of the field, most common first and ignoring nulls, e.g. string or int32|string."},
+			{Name: "types", Type: proto.ColumnType_JSON, Description: "The number of sampled documents that had each BSON type on the field, e.g. {\"string\": 980, \"null\": 2}."},
+			{Name: "documents", Type: proto.ColumnType_INT, Description: "The number of documents that were sampled."},
+			{Name: "present_count", Type: proto.ColumnType_INT, Description: "The number of sampled documents that contained the field, even if it was null."},
+			{Name: "present_ratio", Type: proto.ColumnType_DOUBLE, Description: "The fraction (between 0 and 1) of the sampled documents that contained the field."},
+			{Name: "null_count", Type: proto.ColumnType_INT, Description: "The number of sampled documents where the field was null."},
+			{Name: "distinct_count", Type: proto.ColumnType_INT, Description: "The approximate number of distinct values of the field on the sampled documents. Exact below 256 values. Always 0 for documents."},
+		},
+	}
+}
+
+/*
+listMongoDBFields lists the fields that were seen while sampling the collection of each dynamic table (or only the one on
+the table_name qual), with the statistics of the sample. Nothing is sampled again, so these are the statistics as of
+when the tables were built (see mongodb_schema_drift for a fresh comparison). Tables whose columns were all declared
+(see [schemaPrecedenceOnly]) weren't sampled, so they have no fields here
+*/
+func listMongoDBFields(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+	schemas, tableNames := getTableSchemas(d)
+
+	for _, tableName := range tableNames {
+		schema := schemas[tableName]
+		columns := flattenSchema("", schema.TypeMap)
+
+		paths := make([]string, 0, len(schema.Stats.Fields))
+		for path := range schema.Stats.Fields {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+
+		for _, path := range paths {
+			field := schema.Stats.Fields[path]
+			row := fieldRow{
+				TableName:     tableName,
+				Database:      schema.Namespace.Database,
+				Collection:    schema.Namespace.Collection,
+				Field:         path,
+				Type:          fieldTypes(field),
+				Types:         field.Types,
+				Documents:     schema.Stats.Documents,
+				PresentCount:  field.Count,
+				PresentRatio:  schema.Stats.Presence(path),
+				NullCount:     field.Types["null"],
+				DistinctCount: field.Distinct,
+			}
+			if t, ok := columns[path]; ok {
+				if columnType := schema.columnType(ctx, path, t); columnType != proto.ColumnType_UNKNOWN {
+					columnName, columnTypeName := schema.Paths.name(path), columnType.String()
+					row.ColumnName, row.ColumnType = &columnName, &columnTypeName
+				}
+			}
+
+			d.StreamListItem(ctx, row)
+			if d.RowsRemaining(ctx) == 0 {
+				return nil, nil
+			}
+		}
+	}
+	return nil, nil
+}
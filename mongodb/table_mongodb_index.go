@@ -0,0 +1,120 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/bson"
+	"slices"
+)
+
+// indexRow is a row of the mongodb_index table, built from the output of listIndexes
+// See https://www.mongodb.com/docs/manual/reference/command/listIndexes/#output
+type indexRow struct {
+	Database                string `bson:"-"`
+	Collection              string `bson:"-"`
+	Name                    string `bson:"name"`
+	Version                 int32  `bson:"v"`
+	Unique                  bool   `bson:"unique"`
+	Sparse                  bool   `bson:"sparse"`
+	Hidden                  bool   `bson:"hidden"`
+	ExpireAfterSeconds      *int64 `bson:"expireAfterSeconds"`
+	Keys                    any    `bson:"-"`
+	PartialFilterExpression any    `bson:"-"`
+	Size                    *int64 `bson:"-"`
+}
+
+func tableMongoDBIndex(_ context.Context, _ *plugin.Connection) *plugin.Table {
+	return &plugin.Table{
+		Name:             "mongodb_index",
+		Description:      "Indexes on the collections of the databases that are exposed by this connection",
+		DefaultTransform: transform.FromGo(),
+		List: &plugin.ListConfig{
+			Hydrate: listMongoDBIndexes,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "database", Require: plugin.Optional},
+				{Name: "collection", Require: plugin.Optional},
+			},
+		},
+		Columns: []*plugin.Column{
+			{Name: "database", Type: proto.ColumnType_STRING, Description: "The name of the database that contains the index."},
+			{Name: "collection", Type: proto.ColumnType_STRING, Description: "The name of the collection that the index is defined on."},
+			{Name: "name", Type: proto.ColumnType_STRING, Description: "The name of the index."},
+			{Name: "keys", Type: proto.ColumnType_JSON, Description: "The indexed fields and the type of each, e.g. {\"email\": 1} or {\"location\": \"2dsphere\"}."},
+			{Name: "unique", Type: proto.ColumnType_BOOL, Description: "True if the index rejects duplicate values."},
+			{Name: "sparse", Type: proto.ColumnType_BOOL, Description: "True if the index only contains documents that have the indexed field."},
+			{Name: "hidden", Type: proto.ColumnType_BOOL, Description: "True if the index is hidden from the query planner."},
+			{Name: "partial_filter_expression", Type: proto.ColumnType_JSON, Description: "The filter that documents must match to be included in the index, if it's a partial index."},
+			{Name: "expire_after_seconds", Type: proto.ColumnType_INT, Description: "The TTL of the documents, if this is a TTL index."},
+			{Name: "version", Type: proto.ColumnType_INT, Description: "The version of the index."},
+			{Name: "size", Type: proto.ColumnType_INT, Description: "The size of the index, in bytes."},
+		},
+	}
+}
+
+func listMongoDBIndexes(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+	client, databases, err := getDatabasesForQuery(ctx, d, "database")
+	if err != nil {
+		return nil, err
+	}
+
+	collectionFilter := bson.D{{Key: "type", Value: bson.M{"$ne": "view"}}} // views can't have indexes, but time series collections can
+	if qual, ok := d.EqualsQuals["collection"]; ok {
+		collectionFilter = append(collectionFilter, bson.E{Key: "name", Value: qual.GetStringValue()})
+	}
+
+	for _, database := range databases {
+		collections, err := client.Database(database).ListCollectionNames(ctx, collectionFilter)
+		if err != nil {
+			return nil, err
+		}
+		for _, collection := range collections {
+			coll := client.Database(database).Collection(collection)
+			// $collStats returns the sizes of all indexes at once, so it's only run once per collection, and only if needed
+			var indexSizes map[string]int64
+			if slices.Contains(d.QueryContext.Columns, "size") {
+				stats, err := getCollectionStats(ctx, coll)
+				if err != nil {
+					return nil, err
+				}
+				indexSizes = stats.IndexSizes
+			}
+
+			cursor, err := coll.Indexes().List(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			for cursor.Next(ctx) {
+				row := indexRow{Database: database, Collection: collection}
+				if err := cursor.Decode(&row); err != nil {
+					cursor.Close(ctx)
+					return nil, err
+				}
+				if row.Keys, err = bsonToJSON(cursor.Current.Lookup("key").Document()); err != nil {
+					cursor.Close(ctx)
+					return nil, err
+				}
+				if partial, err := cursor.Current.LookupErr("partialFilterExpression"); err == nil {
+					if row.PartialFilterExpression, err = bsonToJSON(partial.Document()); err != nil {
+						cursor.Close(ctx)
+						return nil, err
+					}
+				}
+
+				if size, ok := indexSizes[row.Name]; ok {
+					row.Size = &size
+				}
+
+				d.StreamListItem(ctx, row)
+				if d.RowsRemaining(ctx) == 0 {
+					cursor.Close(ctx)
+					return nil, nil
+				}
+			}
+			cursor.Close(ctx)
+		}
+	}
+	return nil, nil
+}
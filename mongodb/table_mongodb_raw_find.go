@@ -0,0 +1,159 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+)
+
+// rawFindRow is a row of the mongodb_raw_find table. The rest of the columns are just echoes of the quals
+type rawFindRow struct {
+	Database   string
+	Collection string
+	Document   any
+}
+
+func tableMongoDBRawFind(_ context.Context, _ *plugin.Connection) *plugin.Table {
+	return &plugin.Table{
+		Name:        "mongodb_raw_find",
+		Description: "Run an arbitrary find() query, expressed as MongoDB Extended JSON, on any collection",
+		List: &plugin.ListConfig{
+			Hydrate: listMongoDBRawFind,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "collection", Require: plugin.Required},
+				{Name: "filter", Require: plugin.Required},
+				{Name: "database", Require: plugin.Optional},
+				{Name: "projection", Require: plugin.Optional},
+				{Name: "sort", Require: plugin.Optional},
+				{Name: "skip", Require: plugin.Optional},
+				{Name: "limit", Require: plugin.Optional},
+			},
+		},
+		Columns: []*plugin.Column{
+			{Name: "database", Type: proto.ColumnType_STRING, Transform: transform.FromField("Database"), Description: "The database that contains the collection. Can be omitted if the connection only exposes one database."},
+			{Name: "collection", Type: proto.ColumnType_STRING, Transform: transform.FromField("Collection"), Description: "The collection to query."},
+			{Name: "filter", Type: proto.ColumnType_JSON, Transform: transform.FromQual("filter").Transform(parseJSONQual), Description: "The query filter, e.g. {\"tags\": {\"$elemMatch\": {\"$eq\": \"prod\"}}}. Use {} to return all documents."},
+			{Name: "projection", Type: proto.ColumnType_JSON, Transform: transform.FromQual("projection").Transform(parseJSONQual), Description: "The fields to return, e.g. {\"name\": 1, \"_id\": 0}."},
+			{Name: "sort", Type: proto.ColumnType_JSON, Transform: transform.FromQual("sort").Transform(parseJSONQual), Description: "The sort order, e.g. {\"created_at\": -1}. Note that this only controls the order in which documents are read, use ORDER BY to sort the results."},
+			{Name: "skip", Type: proto.ColumnType_INT, Transform: transform.FromQual("skip"), Description: "The number of documents to skip."},
+			{Name: "limit", Type: proto.ColumnType_INT, Transform: transform.FromQual("limit"), Description: "The maximum number of documents to return."},
+			{Name: "document", Type: proto.ColumnType_JSON, Transform: transform.FromField("Document"), Description: "A matching document, in relaxed Extended JSON format."},
+		},
+	}
+}
+
+func listMongoDBRawFind(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+	database, err := getSingleDatabaseForQuery(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getClientForQuery(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	collection := d.EqualsQualString("collection")
+
+	var filter bson.D
+	if err := parseExtJSONQual(d.EqualsQuals["filter"], &filter); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	opts := options.Find()
+	if qual, ok := d.EqualsQuals["projection"]; ok {
+		var projection bson.D
+		if err := parseExtJSONQual(qual, &projection); err != nil {
+			return nil, fmt.Errorf("invalid projection: %w", err)
+		}
+		opts.SetProjection(projection)
+	}
+	if qual, ok := d.EqualsQuals["sort"]; ok {
+		var sort bson.D
+		if err := parseExtJSONQual(qual, &sort); err != nil {
+			return nil, fmt.Errorf("invalid sort: %w", err)
+		}
+		opts.SetSort(sort)
+	}
+	if qual, ok := d.EqualsQuals["skip"]; ok {
+		opts.SetSkip(qual.GetInt64Value())
+	}
+	if qual, ok := d.EqualsQuals["limit"]; ok {
+		opts.SetLimit(qual.GetInt64Value())
+	} else if d.QueryContext.Limit != nil {
+		opts.SetLimit(*d.QueryContext.Limit)
+	}
+
+	plugin.Logger(ctx).Info("listMongoDBRawFind", "database", database, "collection", collection, "filter", filter)
+	cursor, err := client.Database(database).Collection(collection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) && d.RowsRemaining(ctx) > 0 {
+		document, err := bsonToJSON(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		d.StreamListItem(ctx, rawFindRow{Database: database, Collection: collection, Document: document})
+	}
+	return nil, cursor.Err()
+}
+
+/*
+getSingleDatabaseForQuery returns the database that a raw query should run on: the one that was passed in a
+WHERE database='...' condition, or the only database that is exposed by the connection if there's no such condition.
+In both cases, the database must be one of those that are exposed by the connection
+*/
+func getSingleDatabaseForQuery(ctx context.Context, d *plugin.QueryData) (string, error) {
+	_, databases, err := getDatabasesForQuery(ctx, d, "database")
+	if err != nil {
+		return "", err
+	}
+
+	if database := d.EqualsQualString("database"); database != "" {
+		if !slices.Contains(databases, database) {
+			return "", fmt.Errorf("database %s isn't exposed by this connection", database)
+		}
+		return database, nil
+	}
+	if len(databases) != 1 {
+		return "", fmt.Errorf("this connection exposes %d databases, please choose one with WHERE database='...'", len(databases))
+	}
+	return databases[0], nil
+}
+
+// jsonQualString returns the raw text of a qual on a JSONB column. Depending on how the condition is written, those
+// may come in as either JSONB or string values
+func jsonQualString(qual *proto.QualValue) string {
+	if v := qual.GetJsonbValue(); v != "" {
+		return v
+	}
+	return qual.GetStringValue()
+}
+
+// parseExtJSONQual parses a qual on a JSONB column as MongoDB Extended JSON, so types that have no JSON equivalent can
+// be expressed, e.g. {"_id": {"$oid": "5ca4bbc7a2dd94ee5816238d"}}
+func parseExtJSONQual(qual *proto.QualValue, target any) error {
+	if qual == nil {
+		return nil
+	}
+	return bson.UnmarshalExtJSON([]byte(jsonQualString(qual)), false, target)
+}
+
+// parseJSONQual is a transform that converts the raw text of a JSONB qual back into a JSON value, so it can be echoed on
+// the column of the same name and Postgres sees the same value that it sent
+func parseJSONQual(_ context.Context, d *transform.TransformData) (any, error) {
+	raw, ok := d.Value.(string)
+	if !ok {
+		return d.Value, nil
+	}
+	var result any
+	err := json.Unmarshal([]byte(raw), &result)
+	return result, err
+}
@@ -0,0 +1,125 @@
+package mongodb
+
+import (
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+)
+
+func TestJsonQualString(t *testing.T) {
+	cases := []struct {
+		name     string
+		qual     *proto.QualValue
+		expected string
+	}{
+		{"jsonb", &proto.QualValue{Value: &proto.QualValue_JsonbValue{JsonbValue: `{"a": 1}`}}, `{"a": 1}`},
+		{"string", &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: `{"a": 1}`}}, `{"a": 1}`},
+		{"empty jsonb", &proto.QualValue{Value: &proto.QualValue_JsonbValue{JsonbValue: ""}}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := jsonQualString(tc.qual); got != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseExtJSONQual(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("5ca4bbc7a2dd94ee5816238d")
+	cases := []struct {
+		name     string
+		qual     *proto.QualValue
+		expected bson.D
+		wantErr  bool
+	}{
+		{
+			name:     "plain JSON",
+			qual:     &proto.QualValue{Value: &proto.QualValue_JsonbValue{JsonbValue: `{"name": "Alice", "age": {"$gt": 30}}`}},
+			expected: bson.D{{Key: "name", Value: "Alice"}, {Key: "age", Value: bson.D{{Key: "$gt", Value: int32(30)}}}},
+		},
+		{
+			name:     "Extended JSON",
+			qual:     &proto.QualValue{Value: &proto.QualValue_JsonbValue{JsonbValue: `{"_id": {"$oid": "5ca4bbc7a2dd94ee5816238d"}}`}},
+			expected: bson.D{{Key: "_id", Value: oid}},
+		},
+		{
+			name:     "as a string",
+			qual:     &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: `{}`}},
+			expected: bson.D{},
+		},
+		{
+			name:     "missing qual",
+			qual:     nil,
+			expected: nil,
+		},
+		{
+			name:    "invalid JSON",
+			qual:    &proto.QualValue{Value: &proto.QualValue_JsonbValue{JsonbValue: `{"name": `}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid Extended JSON",
+			qual:    &proto.QualValue{Value: &proto.QualValue_JsonbValue{JsonbValue: `{"_id": {"$oid": "not an id"}}`}},
+			wantErr: true,
+		},
+		{
+			name:    "not a document",
+			qual:    &proto.QualValue{Value: &proto.QualValue_JsonbValue{JsonbValue: `[1, 2]`}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bson.D
+			err := parseExtJSONQual(tc.qual, &got)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, but got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %#v but got %#v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseJSONQual(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    any
+		expected any
+		wantErr  bool
+	}{
+		{"document", `{"a": [1, "b"]}`, map[string]any{"a": []any{float64(1), "b"}}, false},
+		{"Extended JSON is kept as is", `{"$oid": "5ca4bbc7a2dd94ee5816238d"}`, map[string]any{"$oid": "5ca4bbc7a2dd94ee5816238d"}, false},
+		{"missing qual", nil, nil, false},
+		{"not a string", int64(3), int64(3), false},
+		{"invalid JSON", `{"a": `, nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseJSONQual(ctx(), &transform.TransformData{Value: tc.value})
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, but got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %#v but got %#v", tc.expected, got)
+			}
+		})
+	}
+}
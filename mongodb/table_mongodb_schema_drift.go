@@ -0,0 +1,392 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Kinds of changes that are reported by the mongodb_schema_drift table
+const (
+	driftAdded   = "added"
+	driftRemoved = "removed"
+	driftRetyped = "retyped"
+)
+
+// tableSchema is the schema that a dynamic table was built from, so it can be compared with the current documents
+type tableSchema struct {
+	Namespace namespace
+	TypeMap   analyzer.StructType
+	// Stats are those of the documents that TypeMap was inferred from, they're empty if the collection wasn't sampled
+	Stats        analyzer.Stats
+	Paths        columnPaths
+	IgnoreFields []string
+	// ColumnTypes holds the type of each column, keyed by path. It's only needed for the columns whose type wasn't
+	// derived directly from TypeMap, see [resolveColumnType]
+	ColumnTypes map[string]proto.ColumnType
+}
+
+// columnType returns the type of the column of the field at path, whose type on TypeMap is t
+func (s tableSchema) columnType(ctx context.Context, path string, t analyzer.Type) proto.ColumnType {
+	if columnType, ok := s.ColumnTypes[path]; ok {
+		return columnType
+	}
+	return getSteampipeTypeForMongoType(ctx, t)
+}
+
+var (
+	// tableSchemas holds the schema of every dynamic table, keyed by connection name and then by table name
+	tableSchemas     = map[string]map[string]tableSchema{}
+	tableSchemasLock sync.Mutex
+)
+
+// forgetTableSchemas is called before the tables of a connection are (re)built, so tables that no longer exist aren't
+// reported
+func forgetTableSchemas(connectionName string) {
+	tableSchemasLock.Lock()
+	defer tableSchemasLock.Unlock()
+	delete(tableSchemas, connectionName)
+}
+
+func registerTableSchema(connectionName, tableName string, schema tableSchema) {
+	tableSchemasLock.Lock()
+	defer tableSchemasLock.Unlock()
+	if tableSchemas[connectionName] == nil {
+		tableSchemas[connectionName] = map[string]tableSchema{}
+	}
+	tableSchemas[connectionName][tableName] = schema
+}
+
+// lookupTableSchema returns the schema of a single table of a connection, if it was registered
+func lookupTableSchema(connectionName, tableName string) (tableSchema, bool) {
+	tableSchemasLock.Lock()
+	defer tableSchemasLock.Unlock()
+	schema, ok := tableSchemas[connectionName][tableName]
+	return schema, ok
+}
+
+// getTableSchemas returns the schemas of the tables of the connection of a query, and their names, sorted. If there's a
+// table_name qual, only that table is returned
+func getTableSchemas(d *plugin.QueryData) (map[string]tableSchema, []string) {
+	tableSchemasLock.Lock()
+	schemas := make(map[string]tableSchema, len(tableSchemas[d.Connection.Name]))
+	for tableName, schema := range tableSchemas[d.Connection.Name] {
+		schemas[tableName] = schema
+	}
+	tableSchemasLock.Unlock()
+
+	tableNames := make([]string, 0, len(schemas))
+	for tableName := range schemas {
+		tableNames = append(tableNames, tableName)
+	}
+	if qual, ok := d.EqualsQuals["table_name"]; ok {
+		tableNames = slices.DeleteFunc(tableNames, func(n string) bool { return n != qual.GetStringValue() })
+	}
+	slices.Sort(tableNames)
+	return schemas, tableNames
+}
+
+// schemaDriftRow is a row of the mongodb_schema_drift table
+type schemaDriftRow struct {
+	TableName    string
+	Database     string
+	Collection   string
+	Field        string
+	ColumnName   *string
+	Change       string
+	ColumnType   *string
+	ExpectedType *string
+	// ObservedTypes counts the sampled documents that had each type (e.g. "string" or "null") on the field
+	ObservedTypes    map[string]int
+	SampleSize       int
+	SampledDocuments int
+	SampleCount      int
+	MismatchCount    int
+}
+
+func tableMongoDBSchemaDrift(_ context.Context, _ *plugin.Connection) *plugin.Table {
+	return &plugin.Table{
+		Name:             "mongodb_schema_drift",
+		Description:      "Differences between the columns of each collection table and the fields of a fresh sample of its documents",
+		DefaultTransform: transform.FromGo(),
+		List: &plugin.ListConfig{
+			Hydrate: listMongoDBSchemaDrift,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "table_name", Require: plugin.Optional},
+				{Name: "sample_size", Require: plugin.Optional},
+			},
+		},
+		Columns: []*plugin.Column{
+			{Name: "table_name", Type: proto.ColumnType_STRING, Description: "The name of the table."},
+			{Name: "database", Type: proto.ColumnType_STRING, Description: "The name of the database that contains the collection."},
+			{Name: "collection", Type: proto.ColumnType_STRING, Description: "The name of the collection that backs the table."},
+			{Name: "field", Type: proto.ColumnType_STRING, Description: "The path of the field, e.g. customer.name."},
+			{Name: "column_name", Type: proto.ColumnType_STRING, Description: "The column of the table that the field is exposed as, if any."},
+			{Name: "change", Type: proto.ColumnType_STRING, Description: "One of added (the field has no column), removed (the column's field wasn't found on any sampled document) or retyped (some documents have values that don't fit the type of the column)."},
+			{Name: "column_type", Type: proto.ColumnType_STRING, Description: "The Steampipe type of the column, e.g. STRING, INT or JSON."},
+			{Name: "expected_type", Type: proto.ColumnType_STRING, Description: "The BSON type that the table was built with, e.g. string, int32 or object."},
+			{Name: "observed_types", Type: proto.ColumnType_JSON, Description: "The number of sampled documents that had each BSON type on the field."},
+			{Name: "sample_size", Type: proto.ColumnType_INT, Description: "The number of documents to sample, which defaults to sample_size on the config. Set it on the WHERE clause to sample more (or fewer) documents."},
+			{Name: "sampled_documents", Type: proto.ColumnType_INT, Description: "The number of documents that were actually sampled, which may be less than sample_size on small collections."},
+			{Name: "sample_count", Type: proto.ColumnType_INT, Description: "The number of sampled documents that contained the field."},
+			{Name: "mismatch_count", Type: proto.ColumnType_INT, Description: "The number of sampled documents whose value for the field doesn't fit the type of the column."},
+		},
+	}
+}
+
+/*
+listMongoDBSchemaDrift samples the collection of every dynamic table again (or only the one on the table_name qual), and
+compares the fields of the sampled documents with the schema that the table was built from. Tables are only built when
+the plugin loads the schema of the connection, so a non-empty result means that the connection should be reloaded (or
+that some columns should be declared, see [CollectionSchemaConfig])
+*/
+func listMongoDBSchemaDrift(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+	sampleSize, err := driftSampleSize(GetConfig(d.Connection), d.EqualsQuals["sample_size"])
+	if err != nil {
+		return nil, err
+	}
+
+	schemas, tableNames := getTableSchemas(d)
+
+	client, err := getClientForQuery(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tableName := range tableNames {
+		schema := schemas[tableName]
+		ns := schema.Namespace
+		coll := client.Database(ns.Database).Collection(ns.Collection)
+
+		var samplingPipeline mongo.Pipeline
+		if ns.Unwind != "" {
+			// Child tables sample their parents and then unwind them, since a $limit after the $unwind would only see
+			// the arrays of the first few parents
+			if stage := samplingStage(ns.Type, nil, sampleSize); stage != nil {
+				samplingPipeline = append(samplingPipeline, stage)
+			}
+			samplingPipeline = append(samplingPipeline, ns.Pipeline...)
+		} else {
+			samplingPipeline = slices.Clone(ns.Pipeline)
+			if stage := samplingStage(ns.Type, ns.Pipeline, sampleSize); stage != nil {
+				samplingPipeline = append(samplingPipeline, stage)
+			}
+		}
+		cursor, err := coll.Aggregate(ctx, samplingPipeline)
+		if err != nil {
+			return nil, err
+		}
+		g := analyzer.Generator{StopOnFields: schema.IgnoreFields}
+		var sampled []analyzer.StructType
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				cursor.Close(ctx)
+				return nil, err
+			}
+			sampled = append(sampled, g.TypeOf(doc, nil).(analyzer.StructType))
+		}
+		cursor.Close(ctx)
+
+		drifts := compareSchema(ctx, schema.TypeMap, schema.ColumnTypes, sampled)
+		if len(drifts) > 0 {
+			plugin.Logger(ctx).Warn("mongodb.listMongoDBSchemaDrift", "msg", "schema has drifted since the table was built, reload the connection to pick up the changes", "table", tableName, "changes", len(drifts))
+		}
+		for _, drift := range drifts {
+			row := schemaDriftRow{
+				TableName:        tableName,
+				Database:         ns.Database,
+				Collection:       ns.Collection,
+				Field:            drift.Field,
+				Change:           drift.Change,
+				ObservedTypes:    drift.ObservedTypes,
+				SampleSize:       sampleSize,
+				SampledDocuments: len(sampled),
+				SampleCount:      drift.SampleCount,
+				MismatchCount:    drift.MismatchCount,
+			}
+			if drift.Expected != nil {
+				expectedType := analyzer.TypeName(drift.Expected)
+				row.ExpectedType = &expectedType
+			}
+			if drift.IsColumn {
+				columnName := schema.Paths.name(drift.Field)
+				columnType := schema.columnType(ctx, drift.Field, drift.Expected).String()
+				row.ColumnName, row.ColumnType = &columnName, &columnType
+			}
+
+			d.StreamListItem(ctx, row)
+			if d.RowsRemaining(ctx) == 0 {
+				return nil, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+/*
+driftSampleSize returns the number of documents to sample, which is the sample_size qual if there's one, or the
+sample_size of the config otherwise. The qual must be positive: 0 (or a negative value) would read the entire collection
+(see [samplingStage]), which isn't something that should happen because of a typo on a WHERE clause. Set sample_size to
+0 on the config to compare the schemas against every document instead
+*/
+func driftSampleSize(cfg MongoDBConfig, qual *proto.QualValue) (int, error) {
+	if qual == nil {
+		return cfg.GetSampleSize(), nil
+	}
+	sampleSize := qual.GetInt64Value()
+	if sampleSize <= 0 {
+		return 0, fmt.Errorf("sample_size must be positive, but it was %d", sampleSize)
+	}
+	return int(sampleSize), nil
+}
+
+// fieldDrift is a difference between the schema of a table and the sampled documents, on a single field
+type fieldDrift struct {
+	Field  string
+	Change string
+	// Expected is the type that the table was built with, or nil for fields that were added
+	Expected analyzer.Type
+	// IsColumn is false for added fields, and for documents that have columns for their fields but were found to hold
+	// something else (e.g. a string where {"name": {"first": ...}} was expected)
+	IsColumn      bool
+	ObservedTypes map[string]int
+	SampleCount   int
+	MismatchCount int
+}
+
+/*
+compareSchema compares the schema of a table with the types of some sampled documents, which must have been obtained
+with [analyzer.Generator.TypeOf] on each document. columnTypes overrides the types of some columns, as in
+[tableSchema.ColumnTypes]. It returns, sorted by field:
+  - The columns whose fields weren't found on any document (removed)
+  - The fields that don't have a column (added). Fields under JSONB columns are part of that column, so they're not
+    reported, and neither are documents that are empty on some documents but were seen with fields before
+  - The columns that had values of a type that doesn't fit the column on some documents (retyped), see [typeFitsColumn].
+    Documents that were exploded into columns (e.g. "name" into "name.first" and "name.last") but that held something
+    else on some documents are reported as retyped too
+*/
+func compareSchema(ctx context.Context, expected analyzer.StructType, columnTypes map[string]proto.ColumnType, sampled []analyzer.StructType) []fieldDrift {
+	schema := tableSchema{ColumnTypes: columnTypes}
+	columns := flattenSchema("", expected)
+	for path, t := range columns {
+		if schema.columnType(ctx, path, t) == proto.ColumnType_UNKNOWN {
+			delete(columns, path) // these fields don't have columns, see tableMongoDB
+		}
+	}
+	drifts := map[string]*fieldDrift{}
+	observe := func(path string, expectedType analyzer.Type, isColumn bool, observed analyzer.Type) {
+		drift, ok := drifts[path]
+		if !ok {
+			drift = &fieldDrift{Field: path, Expected: expectedType, IsColumn: isColumn, ObservedTypes: map[string]int{}}
+			drifts[path] = drift
+		}
+		drift.SampleCount++
+		drift.ObservedTypes[analyzer.TypeName(observed)]++
+		switch {
+		case expectedType == nil:
+			drift.MismatchCount++
+		case isColumn && !typeFitsColumn(ctx, schema.columnType(ctx, path, expectedType), observed):
+			drift.MismatchCount++
+		case !isColumn && !isStruct(observed):
+			drift.MismatchCount++
+		}
+	}
+
+	for _, doc := range sampled {
+		seen := map[string]bool{} // a field is only counted once per document
+		for path, observed := range flattenSchema("", doc) {
+			if expectedType, ok := columns[path]; ok {
+				observe(path, expectedType, true, observed)
+				continue
+			}
+			if column := columnAncestor(columns, path); column != "" {
+				// A document where the column expects something else, e.g. {"a": {"b": 1}} where "a" was a string
+				if !seen[column] {
+					seen[column] = true
+					observe(column, columns[column], true, analyzer.StructType{})
+				}
+				continue
+			}
+			if hasColumnDescendant(columns, path) {
+				if !isStruct(observed) {
+					observe(path, analyzer.StructType{}, false, observed)
+				}
+				continue // an empty document, where documents with fields were seen before
+			}
+			observe(path, nil, false, observed)
+		}
+	}
+
+	var result []fieldDrift
+	for path, expectedType := range columns {
+		if _, ok := drifts[path]; !ok {
+			result = append(result, fieldDrift{Field: path, Change: driftRemoved, Expected: expectedType, IsColumn: true, ObservedTypes: map[string]int{}})
+		}
+	}
+	for _, drift := range drifts {
+		switch {
+		case drift.Expected == nil:
+			drift.Change = driftAdded
+		case drift.MismatchCount > 0:
+			drift.Change = driftRetyped
+		default:
+			continue
+		}
+		result = append(result, *drift)
+	}
+	slices.SortFunc(result, func(a, b fieldDrift) int { return strings.Compare(a.Field, b.Field) })
+	return result
+}
+
+// columnAncestor returns the column that contains the field at path, if the field is inside one (e.g. "a" for "a.b")
+func columnAncestor(columns map[string]analyzer.Type, path string) string {
+	for i := strings.LastIndex(path, "."); i > 0; i = strings.LastIndex(path[:i], ".") {
+		if _, ok := columns[path[:i]]; ok {
+			return path[:i]
+		}
+	}
+	return ""
+}
+
+// hasColumnDescendant reports whether any column is inside the field at path (e.g. "a.b" for "a")
+func hasColumnDescendant(columns map[string]analyzer.Type, path string) bool {
+	for column := range columns {
+		if strings.HasPrefix(column, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+typeFitsColumn reports whether values of type observed can be presented on a column of type expected. Nulls fit on any column, and anything fits on JSONB columns, apart from the BSON types that can't be presented at all
+(e.g. MinKey). Other types must map to the same Postgres type, except that integers fit on DOUBLE columns
+*/
+func typeFitsColumn(ctx context.Context, expectedColumn proto.ColumnType, observed analyzer.Type) bool {
+	if observed == analyzer.NilType {
+		return true
+	}
+	observedColumn := getSteampipeTypeForMongoType(ctx, observed)
+	switch {
+	case observedColumn == proto.ColumnType_UNKNOWN:
+		return false
+	case expectedColumn == proto.ColumnType_JSON || expectedColumn == observedColumn:
+		return true
+	default:
+		return expectedColumn == proto.ColumnType_DOUBLE && observedColumn == proto.ColumnType_INT
+	}
+}
+
+func isStruct(t analyzer.Type) bool {
+	_, ok := t.(analyzer.StructType)
+	return ok
+}
@@ -0,0 +1,117 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+)
+
+// sampleTypes converts documents in the same way as listMongoDBSchemaDrift does with the sampled documents
+func sampleTypes(docs ...bson.M) []analyzer.StructType {
+	g := analyzer.Generator{}
+	types := make([]analyzer.StructType, len(docs))
+	for i, doc := range docs {
+		types[i] = g.TypeOf(doc, nil).(analyzer.StructType)
+	}
+	return types
+}
+
+func TestCompareSchema(t *testing.T) {
+	expected := analyzer.StructType{
+		"_id":    analyzer.PrimitiveObjectId,
+		"amount": analyzer.PrimitiveInt32,
+		"price":  analyzer.PrimitiveDouble,
+		"name": analyzer.StructType{
+			"first": analyzer.PrimitiveString,
+			"last":  analyzer.PrimitiveString,
+		},
+		"legacy": analyzer.PrimitiveString,
+		"tags":   analyzer.SliceType{Type: analyzer.PrimitiveString},
+	}
+	sampled := sampleTypes(
+		bson.M{"_id": primitive.NewObjectID(), "amount": int32(1), "price": int32(3), "name": bson.M{"first": "A", "last": "B"}, "tags": bson.A{"x"}},
+		bson.M{"_id": primitive.NewObjectID(), "amount": "1.5", "price": 2.5, "name": "A B", "tags": bson.A{int32(1)}, "email": "a@b.c"},
+		bson.M{"_id": primitive.NewObjectID(), "amount": nil, "name": bson.M{}, "email": nil},
+	)
+
+	drifts := compareSchema(ctx(), expected, nil, sampled)
+	expectedDrifts := []fieldDrift{
+		{Field: "amount", Change: driftRetyped, Expected: analyzer.PrimitiveInt32, IsColumn: true, ObservedTypes: map[string]int{"int32": 1, "string": 1, "null": 1}, SampleCount: 3, MismatchCount: 1},
+		{Field: "email", Change: driftAdded, ObservedTypes: map[string]int{"string": 1, "null": 1}, SampleCount: 2, MismatchCount: 2},
+		{Field: "legacy", Change: driftRemoved, Expected: analyzer.PrimitiveString, IsColumn: true, ObservedTypes: map[string]int{}},
+		{Field: "name", Change: driftRetyped, Expected: analyzer.StructType{}, ObservedTypes: map[string]int{"string": 1}, SampleCount: 1, MismatchCount: 1},
+	}
+	if !reflect.DeepEqual(drifts, expectedDrifts) {
+		t.Errorf("Expected drifts to be\n%+v\nbut they were\n%+v", expectedDrifts, drifts)
+	}
+}
+
+func TestCompareSchemaFieldsInsideJSONColumns(t *testing.T) {
+	expected := analyzer.StructType{
+		"metadata": analyzer.StructType{},
+		"code":     analyzer.PrimitiveString,
+	}
+	sampled := sampleTypes(
+		bson.M{"metadata": bson.M{"source": "api"}, "code": "a"},
+		bson.M{"metadata": "none", "code": bson.M{"value": "b"}},
+	)
+
+	drifts := compareSchema(ctx(), expected, nil, sampled)
+	expectedDrifts := []fieldDrift{
+		{Field: "code", Change: driftRetyped, Expected: analyzer.PrimitiveString, IsColumn: true, ObservedTypes: map[string]int{"string": 1, "object": 1}, SampleCount: 2, MismatchCount: 1},
+	}
+	if !reflect.DeepEqual(drifts, expectedDrifts) {
+		t.Errorf("Expected drifts to be\n%+v\nbut they were\n%+v", expectedDrifts, drifts)
+	}
+}
+
+func TestCompareSchemaWithoutDrift(t *testing.T) {
+	g := analyzer.Generator{}
+	docs := []bson.M{
+		{"_id": int32(1), "name": bson.M{"first": "A"}, "tags": bson.A{"x"}},
+		{"_id": int32(2), "name": bson.M{"first": nil}, "tags": bson.A{}},
+	}
+	for _, doc := range docs {
+		g.Update(doc)
+	}
+
+	if drifts := compareSchema(ctx(), g.GetType().(analyzer.StructType), nil, sampleTypes(docs...)); len(drifts) > 0 {
+		t.Errorf("Expected no drift when sampling the same documents, got %+v", drifts)
+	}
+}
+
+func TestDriftSampleSize(t *testing.T) {
+	configured := 500
+	cfg := MongoDBConfig{SampleSize: &configured}
+	cases := []struct {
+		name     string
+		qual     *proto.QualValue
+		expected int
+		wantErr  bool
+	}{
+		{"from the config", nil, 500, false},
+		{"from the qual", proto.NewQualValue(int64(10000)), 10000, false},
+		{"zero", proto.NewQualValue(int64(0)), 0, true},
+		{"negative", proto.NewQualValue(int64(-1)), 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sampleSize, err := driftSampleSize(cfg, tc.qual)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, but got %d", sampleSize)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if sampleSize != tc.expected {
+				t.Errorf("Expected %d but got %d", tc.expected, sampleSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package mongodb
+
+import (
+	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
+	"testing"
+)
+
+func TestColumnDescription(t *testing.T) {
+	stats := analyzer.Stats{Documents: 1000, Fields: map[string]analyzer.FieldStats{
+		"email":  {Count: 982, Types: map[string]int{"string": 980, "null": 2}},
+		"amount": {Count: 1000, Types: map[string]int{"int32": 300, "double": 700}},
+		"ts":     {Count: 1000, Types: map[string]int{"date": 1000}},
+		"gone":   {Count: 5, Types: map[string]int{"null": 5}},
+	}}
+	ns := namespace{TimeField: "ts", MetaField: "meta"}
+
+	testCases := map[string]string{
+		"email":     "Field email (string, 98.2% present)",
+		"amount":    "Field amount (double|int32, 100.0% present)",
+		"ts":        "Field ts (date, 100.0% present, time field of the time series collection)",
+		"gone":      "Field gone (null, 0.5% present)",
+		"meta.site": "Field meta.site (metadata of the time series collection)",
+		"declared":  "Field declared",
+	}
+	for path, expected := range testCases {
+		if actual := columnDescription(ns, path, stats); actual != expected {
+			t.Errorf("Expected the description of %s to be %q, got %q", path, expected, actual)
+		}
+	}
+
+	if actual := columnDescription(namespace{}, "email", analyzer.Stats{}); actual != "Field email" {
+		t.Errorf("Expected a plain description without stats, got %q", actual)
+	}
+}
@@ -2,7 +2,10 @@ package mongodb
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
@@ -15,48 +18,262 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"path"
+	"regexp"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func connect(ctx context.Context, connectionString string) (*mongo.Client, error) {
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
-	return client, err
+// systemDatabases are only exposed if they're explicitly requested by name, never via a glob
+var systemDatabases = []string{"admin", "config", "local"}
+
+/*
+getDatabasesMatching returns the names of all databases on the server that match at least one of the provided glob
+patterns, in the order in which they were first matched. Patterns that don't contain any glob characters are returned
+as-is, so a plain database name keeps working even if the user can't run listDatabases
+*/
+func getDatabasesMatching(ctx context.Context, client *mongo.Client, patterns []string) ([]string, error) {
+	var allDatabases []string
+	databases := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[\\") {
+			if !slices.Contains(databases, pattern) {
+				databases = append(databases, pattern)
+			}
+			continue
+		}
+
+		if allDatabases == nil { // lazily fetch the list of databases, only the first time that a glob is found
+			var err error
+			allDatabases, err = client.ListDatabaseNames(ctx, bson.D{}, options.ListDatabases().SetAuthorizedDatabases(true))
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, database := range allDatabases {
+			if slices.Contains(databases, database) || slices.Contains(systemDatabases, database) {
+				continue
+			}
+			if ok, _ := path.Match(pattern, database); ok {
+				databases = append(databases, database)
+			}
+		}
+	}
+	return databases, nil
 }
 
-func getCollectionsOnDatabase(ctx context.Context, connectionString string, dbName string) ([]string, error) {
-	client, err := connect(ctx, connectionString)
+/*
+getDatabasesForQuery returns a client and the list of databases that a static table should read from: those configured
+on the connection, further restricted to a single one if the query has a qual like WHERE [qualColumn]='dbname'
+*/
+func getDatabasesForQuery(ctx context.Context, d *plugin.QueryData, qualColumn string) (*mongo.Client, []string, error) {
+	config := GetConfig(d.Connection)
+	patterns, err := config.GetDatabases()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := getClientForQuery(ctx, d)
+	if err != nil {
+		return nil, nil, err
+	}
+	databases, err := getDatabasesMatching(ctx, client, patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if qual, ok := d.EqualsQuals[qualColumn]; ok {
+		wanted := qual.GetStringValue()
+		if !slices.Contains(databases, wanted) {
+			return client, []string{}, nil
+		}
+		return client, []string{wanted}, nil
+	}
+	return client, databases, nil
+}
+
+// Collection types, as reported by listCollections
+const (
+	collectionTypeCollection = "collection"
+	collectionTypeView       = "view"
+	collectionTypeTimeSeries = "timeseries"
+)
+
+// collectionInfo is the relevant information about a collection, as reported by listCollections
+type collectionInfo struct {
+	Name string
+	// Type is one of collectionTypeCollection, collectionTypeView or collectionTypeTimeSeries
+	Type string
+	// TimeField and MetaField are only set for time series collections (and MetaField is optional even then)
+	TimeField string
+	MetaField string
+	// OptionsHash is a hash of the options of the collection (e.g. its validator, or the pipeline of a view), which is
+	// used to notice when they change
+	OptionsHash string
+}
+
+/*
+getCollectionsOnDatabase lists the collections on a database, along with their types. System collections (those whose
+names start with "system.", such as system.views or the system.buckets.* collections that back time series collections)
+are only returned if includeSystem is true
+*/
+func getCollectionsOnDatabase(ctx context.Context, client *mongo.Client, dbName string, includeSystem bool) ([]collectionInfo, error) {
+	specs, err := client.Database(dbName).ListCollectionSpecifications(ctx, bson.D{})
 	if err != nil {
 		return nil, err
 	}
 
-	collNames, err := client.Database(dbName).ListCollectionNames(ctx, bson.D{})
-	return collNames, err
+	collections := make([]collectionInfo, 0, len(specs))
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Name, "system.") && !includeSystem {
+			continue
+		}
+		optionsHash := sha256.Sum256(spec.Options)
+		info := collectionInfo{Name: spec.Name, Type: spec.Type, OptionsHash: hex.EncodeToString(optionsHash[:])}
+		if spec.Type == collectionTypeTimeSeries {
+			info.TimeField, _ = spec.Options.Lookup("timeseries", "timeField").StringValueOK()
+			info.MetaField, _ = spec.Options.Lookup("timeseries", "metaField").StringValueOK()
+		}
+		collections = append(collections, info)
+	}
+	return collections, nil
+}
+
+// indexedFields describes the indexes of a collection, as far as filtering on a single field is concerned
+type indexedFields struct {
+	// Indexed are the fields that are the first key of some index, so a filter on just that field can use the index
+	Indexed []string
+	// Unique are the fields that are covered by a single-field unique index, so an equality on any of them matches
+	// at most one document
+	Unique []string
 }
 
-func getFieldTypesForCollection(ctx context.Context, collection *mongo.Collection, sampleSize int, ignoreFields []string) (analyzer.StructType, error) {
-	// grab some random docs from the collection
-	samplingPipeline := bson.D{
-		{"$sample", bson.M{"size": sampleSize}},
+/*
+getIndexedFields lists the indexes of a collection, see [indexedFields]. Partial indexes are skipped, since they can only
+be used by queries that also match their filter, and they only enforce uniqueness on the documents that match it too.
+The _id index is always unique, even though listIndexes doesn't flag it as such
+*/
+func getIndexedFields(ctx context.Context, coll *mongo.Collection) (indexedFields, error) {
+	var fields indexedFields
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return fields, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		if _, isPartial := cursor.Current.Lookup("partialFilterExpression").DocumentOK(); isPartial {
+			continue
+		}
+		keys, _ := cursor.Current.Lookup("key").DocumentOK()
+		elements, _ := keys.Elements()
+		if len(elements) == 0 {
+			continue
+		}
+		field := elements[0].Key()
+		if strings.Contains(field, "$**") || field == "_fts" {
+			continue // wildcard and text indexes can't be used by plain filters
+		}
+		if !slices.Contains(fields.Indexed, field) {
+			fields.Indexed = append(fields.Indexed, field)
+		}
+
+		// compound indexes are only unique on the combination of their fields
+		unique, _ := cursor.Current.Lookup("unique").BooleanOK()
+		if len(elements) == 1 && (field == "_id" || unique) && !slices.Contains(fields.Unique, field) {
+			fields.Unique = append(fields.Unique, field)
+		}
 	}
-	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{samplingPipeline})
+	return fields, cursor.Err()
+}
+
+/*
+samplingStage returns the pipeline stage that should be used to pick sampleSize documents to infer a schema from, or
+nil if all documents should be read. Plain collections (including time series collections) use $sample, which picks
+random documents efficiently. Views, and the pipelines that are declared in the config, use $limit instead, because
+$sample on the output of a pipeline forces the entire pipeline to run before a single document can be returned
+*/
+func samplingStage(collectionType string, pipeline mongo.Pipeline, sampleSize int) bson.D {
+	if sampleSize <= 0 {
+		return nil
+	}
+	if collectionType == collectionTypeView || len(pipeline) > 0 {
+		return bson.D{{Key: "$limit", Value: sampleSize}}
+	}
+	return bson.D{{Key: "$sample", Value: bson.M{"size": sampleSize}}}
+}
+
+// bsonToJSON converts an arbitrary BSON value (usually a document) to plain JSON-compatible Go values, using the
+// relaxed Extended JSON representation for those BSON types that have no JSON equivalent (e.g. {"$oid": "..."})
+func bsonToJSON(v any) (any, error) {
+	asJSON, err := bson.MarshalExtJSON(v, false, false)
 	if err != nil {
 		return nil, err
 	}
+	var result any
+	err = json.Unmarshal(asJSON, &result)
+	return result, err
+}
+
+/*
+parsePipeline parses an aggregation pipeline, written as a JSON array of stages in MongoDB Extended JSON format, e.g.
+[{"$match": {"_id": {"$oid": "5ca4bbc7a2dd94ee5816238d"}}}, {"$project": {"name": 1}}].
+Pipelines that write to a collection ($out and $merge) are rejected, since pipelines are only ever run by SELECTs, and
+those stages must be the last one, so they'd also break the $match and $limit stages that are appended to pipelines
+*/
+func parsePipeline(raw string) (mongo.Pipeline, error) {
+	// Extended JSON can only be unmarshalled from a document, not from a bare array, so wrap the array in one
+	var wrapper struct {
+		Pipeline mongo.Pipeline `bson:"pipeline"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(fmt.Sprintf(`{"pipeline": %s}`, raw)), false, &wrapper); err != nil {
+		return nil, err
+	}
+	for _, stage := range wrapper.Pipeline {
+		for _, op := range stage {
+			if op.Key == "$out" || op.Key == "$merge" {
+				return nil, fmt.Errorf("%s stages aren't allowed, since they write to a collection", op.Key)
+			}
+		}
+	}
+	return wrapper.Pipeline, nil
+}
+
+/*
+getFieldTypesForCollection infers the schema of a collection. If pipeline isn't empty, the schema of the output of that
+aggregation pipeline is inferred instead (this is used for the views that are declared in the config).
+The documents are picked by sampleStage (see [samplingStage]), or all of them are read if it's nil. The statistics of
+the sampled documents (e.g. how often each field appeared) are also returned
+*/
+func getFieldTypesForCollection(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline, sampleStage bson.D, ignoreFields []string) (analyzer.StructType, analyzer.Stats, error) {
+	// grab some random docs from the collection
+	samplingPipeline := slices.Clone(pipeline)
+	if sampleStage != nil {
+		samplingPipeline = append(samplingPipeline, sampleStage)
+	}
+	cursor, err := collection.Aggregate(ctx, samplingPipeline)
+	if err != nil {
+		return nil, analyzer.Stats{}, err
+	}
 	defer cursor.Close(ctx)
 	g := analyzer.Generator{StopOnFields: ignoreFields}
 
 	for cursor.Next(ctx) {
 		var sampleDoc bson.M
 		if err := cursor.Decode(&sampleDoc); err != nil {
-			return nil, err
+			return nil, analyzer.Stats{}, err
 		}
 		// Feed this new document into the Generator, so it updates its type map
 		g.Update(sampleDoc)
 	}
 	// After feeding all the sample docs into the Generator, read out the final type map
-	typeMap := g.GetType().(analyzer.StructType)
+	// If no documents were read at all (e.g. empty collection), the Generator has no type, so report an empty struct
+	typeMap, ok := g.GetType().(analyzer.StructType)
+	if !ok || typeMap == nil {
+		typeMap = analyzer.StructType{}
+	}
 	// typeMap is a specification inferred from ALL the observed documents (those that were passed to [analyzer.Generator.Update])
 	// typeMap may look like this:
 	// StructType {
@@ -69,7 +286,7 @@ func getFieldTypesForCollection(ctx context.Context, collection *mongo.Collectio
 	//   "active_features": SliceType{PrimitiveString},
 	// }
 
-	return typeMap, nil
+	return typeMap, g.GetStats(), nil
 }
 
 func convertMongoTypeToColumnTypes(ctx context.Context, typeMap analyzer.StructType) (map[string]proto.ColumnType, error) {
@@ -122,8 +339,8 @@ func getSteampipeTypeForMongoType(ctx context.Context, mongoType analyzer.Type)
 		if mongoType.IsNilAndOther() {
 			return getSteampipeTypeForMongoType(ctx, mongoType.GetNonNilType())
 		}
-		// Any other MixedTypes that aren't Union[nil, T] must be presented as a JSONB column, because there's no clean type for it
-		// TODO: But what about, e.g. MixedType{string, Symbol}? It could be presented as TEXT anyways, because both child types become TEXT on Postgres
+		// Any other MixedTypes that aren't Union[nil, T] are presented as a JSONB column, because there's no clean type for
+		// it. Depending on the mixed_type_strategy, tableMongoDB may pick a narrower type instead, see resolveColumnType
 		return proto.ColumnType_JSON
 	case analyzer.PrimitiveType:
 		switch mongoType {
@@ -262,14 +479,94 @@ func mongoTransformFunction(ctx context.Context, d *transform.TransformData) (an
 		return string(converted), nil
 	default:
 		plugin.Logger(ctx).Error("mongodb.getSteampipeTypeForMongoValue", "msg", "unknown type", "val", val)
-		return nil, fmt.Errorf("received unknown value %v with type %T", val, val)
+		// The type wasn't seen while sampling, so the schema has probably drifted since the table was built
+		return nil, fmt.Errorf("received unknown value %v with type %T on column %s, the collection may have changed since its schema was inferred (see the mongodb_schema_drift table)", val, val, d.ColumnName)
 	}
 }
 
+/*
+columnsToProjection builds a MongoDB projection that only returns the fields that back the requested columns (i.e.
+those in [plugin.QueryContext.Columns]), so documents with large fields that aren't used by the query can be read
+cheaply. Column names map directly to (possibly dotted) field paths, e.g. the column "name.first" is the path
+"name.first".
+
+MongoDB rejects projections that contain both a path and one of its ancestors (e.g. "name" and "name.first"), so only
+the ancestor is kept in that case, since it already includes the child. _id is always returned by MongoDB unless it's
+explicitly excluded, so it's excluded if it isn't requested. If no columns are requested at all (e.g. on
+select count(*)), only _id is returned, so MongoDB still returns one (tiny) document per row.
+*/
+func columnsToProjection(requestedColumns []string, tableColumns []*plugin.Column) bson.D {
+	paths := make([]string, 0, len(requestedColumns))
+	for _, colName := range requestedColumns {
+		// Ignore columns that don't map to a field, such as Steampipe's _ctx
+		if slices.ContainsFunc(tableColumns, func(c *plugin.Column) bool { return c.Name == colName }) {
+			paths = append(paths, colName)
+		}
+	}
+	if len(paths) == 0 {
+		return bson.D{{Key: "_id", Value: 1}}
+	}
+
+	// After sorting, every path comes after its ancestors (if any), since "name" < "name.first"
+	slices.Sort(paths)
+	projection := bson.D{}
+	for _, p := range paths {
+		coveredByAncestor := slices.ContainsFunc(projection, func(e bson.E) bool {
+			return p == e.Key || strings.HasPrefix(p, e.Key+".")
+		})
+		if !coveredByAncestor {
+			projection = append(projection, bson.E{Key: p, Value: 1})
+		}
+	}
+
+	if !slices.Contains(paths, "_id") {
+		projection = append(projection, bson.E{Key: "_id", Value: 0})
+	}
+	return projection
+}
+
+/*
+pushableOperators lists the operators that [qualsToMongoFilter] can translate for each Steampipe column type. Any other
+operator isn't declared on the key columns, so Steampipe never sends it and always applies it itself
+*/
+var pushableOperators = map[proto.ColumnType][]string{
+	proto.ColumnType_STRING: {
+		quals.QualOperatorEqual, quals.QualOperatorNotEqual,
+		quals.QualOperatorLess, quals.QualOperatorLessOrEqual, quals.QualOperatorGreater, quals.QualOperatorGreaterOrEqual,
+		quals.QualOperatorRegex, quals.QualOperatorNotRegex, quals.QualOperatorIRegex, quals.QualOperatorNotIRegex,
+		quals.QualOperatorLike, quals.QualOperatorNotLike, quals.QualOperatorILike, quals.QualOperatorNotILike,
+		quals.QualOperatorIsNull, quals.QualOperatorIsNotNull,
+	},
+	proto.ColumnType_INT: {
+		quals.QualOperatorEqual, quals.QualOperatorNotEqual,
+		quals.QualOperatorLess, quals.QualOperatorLessOrEqual, quals.QualOperatorGreater, quals.QualOperatorGreaterOrEqual,
+		quals.QualOperatorIsNull, quals.QualOperatorIsNotNull,
+	},
+	proto.ColumnType_DOUBLE: {
+		quals.QualOperatorEqual, quals.QualOperatorNotEqual,
+		quals.QualOperatorLess, quals.QualOperatorLessOrEqual, quals.QualOperatorGreater, quals.QualOperatorGreaterOrEqual,
+		quals.QualOperatorIsNull, quals.QualOperatorIsNotNull,
+	},
+	proto.ColumnType_TIMESTAMP: {
+		quals.QualOperatorEqual, quals.QualOperatorNotEqual,
+		quals.QualOperatorLess, quals.QualOperatorLessOrEqual, quals.QualOperatorGreater, quals.QualOperatorGreaterOrEqual,
+		quals.QualOperatorIsNull, quals.QualOperatorIsNotNull,
+	},
+	proto.ColumnType_BOOL: {
+		quals.QualOperatorEqual, quals.QualOperatorNotEqual,
+		quals.QualOperatorIsNull, quals.QualOperatorIsNotNull,
+	},
+	proto.ColumnType_JSON: {
+		quals.QualOperatorJsonbContainsLeftRight,
+		quals.QualOperatorJsonbExistsOne, quals.QualOperatorJsonbExistsAny, quals.QualOperatorJsonbExistsAll,
+		quals.QualOperatorIsNull, quals.QualOperatorIsNotNull,
+	},
+}
+
 func qualsForColumnOfType(colName string, t proto.ColumnType) *plugin.KeyColumn {
 	return &plugin.KeyColumn{
 		Name:      colName,
-		Operators: plugin.GetValidOperators(), // Accept ALL THE THINGS!
+		Operators: pushableOperators[t],
 		Require:   plugin.Optional,
 	}
 }
@@ -285,97 +582,663 @@ Some examples:
   - WHERE field1='val1' AND field2>1 => {"field1": {"$eq": "val1"}, "field2": {"$gt": 1}}
   - WHERE string_field!~'[Ss]teampipe' => {"string_field": {"$not": {"$regex": "[Ss]teampipe"}}}
   - WHERE _id='5ca4bbc7a2dd94ee5816238d' => {"_id": {"$eq": ObjectID("5ca4bbc7a2dd94ee5816238d")}}
+  - WHERE name LIKE 'Steam%' => {"name": {"$regex": "^Steam"}}
+  - WHERE name ILIKE '%pipe' => {"name": {"$regex": "pipe$", "$options": "i"}}
+  - WHERE tags @> '["prod"]' => {"tags": {"$all": ["prod"]}}
+  - WHERE address @> '{"country": "EC"}' => {"address.country": "EC"}
+  - WHERE status IN ('a', 'b') => {"status": {"$in": ["a", "b"]}}
+  - WHERE status NOT IN ('a', 'b') => {"status": {"$nin": ["a", "b"]}}
+
+Quals that can't be translated are left out of the filter, and Postgres applies them anyway. The second return value is
+false if any qual was left out (or only partially translated), since a LIMIT can't be pushed down in that case: MongoDB
+would return the first documents that match a broader filter, and Postgres could then discard some of them
 */
-func qualsToMongoFilter(ctx context.Context, inputQuals plugin.KeyColumnQualMap, columnsSp []*plugin.Column, columnsMongo analyzer.StructType) bson.D {
+func qualsToMongoFilter(ctx context.Context, inputQuals plugin.KeyColumnQualMap, columnsSp []*plugin.Column, columnsMongo analyzer.StructType) (bson.D, bool) {
 	filter := bson.D{}
+	complete := true
 	for _, filteredColumn := range inputQuals {
 		for _, qual := range filteredColumn.Quals {
-			colName := qual.Column
 			plugin.Logger(ctx).Info("qualsToMongoFilter", qual)
-			colIndex := slices.IndexFunc(columnsSp, func(c *plugin.Column) bool { return c.Name == colName })
-			col := columnsSp[colIndex]
-
-			var filterValue any
-			switch col.Type {
-			case proto.ColumnType_STRING:
-				filterValue = qual.Value.GetStringValue()
-			case proto.ColumnType_JSON: // Supported JSONB operators (e.g. ExistsOne) still receive strings on RHS
-				filterValue = qual.Value.GetStringValue()
-			case proto.ColumnType_INT:
-				filterValue = qual.Value.GetInt64Value()
-			case proto.ColumnType_DOUBLE:
-				filterValue = qual.Value.GetDoubleValue()
-			case proto.ColumnType_BOOL:
-				filterValue = qual.Value.GetBoolValue()
-			case proto.ColumnType_TIMESTAMP:
-				filterValue = qual.Value.GetTimestampValue().AsTime()
-			}
+			conditions, exact := qualToMongoFilter(ctx, qual, columnsSp, columnsMongo)
+			filter = append(filter, conditions...)
+			complete = complete && exact
+		}
+	}
+	return filter, complete
+}
 
-			// Special handling for columns that came from ObjectID fields:
-			// ObjectID columns are presented as STRING (TEXT), but when applying quals we need to use the actual ObjectIDs
-			// In other words, if _id was an ObjectID and we receive WHERE _id='asdfg...', that will come in as a qual
-			// on a STRING column. However, for MongoDB, {_id: {$eq: "asdfg..."}} does NOT work as expected:
-			// Mongo requires comparisons to ObjectIDs to be explicit, e.g. {_id: {$eq: ObjectID("asdfg...")}}
-			mongoType, err := columnsMongo.GetTypeOfChild(colName) // grab type of original/source field
-			if err != nil {                                        // Couldn't get the original Mongo type, skip this qual
-				plugin.Logger(ctx).Error(err.Error())
+/*
+qualToMongoFilter translates a single qual for [qualsToMongoFilter]. The second return value is false if the returned
+conditions (if any) don't match exactly the same documents as the qual, e.g. because the qual can't be pushed down for
+the type of its field, so Postgres must still apply it and a LIMIT must not be pushed down along with the filter
+*/
+func qualToMongoFilter(ctx context.Context, qual *quals.Qual, columnsSp []*plugin.Column, columnsMongo analyzer.StructType) (bson.D, bool) {
+	colName := qual.Column
+	colIndex := slices.IndexFunc(columnsSp, func(c *plugin.Column) bool { return c.Name == colName })
+	if colIndex < 0 {
+		return nil, false
+	}
+	col := columnsSp[colIndex]
+
+	mongoType, err := columnsMongo.GetTypeOfChild(colName) // grab type of original/source field
+	if err != nil {                                        // Couldn't get the original Mongo type, skip this qual
+		plugin.Logger(ctx).Error(err.Error())
+		return nil, false
+	}
+
+	if mixed, ok := mongoType.(analyzer.MixedType); ok && !mixed.IsNilAndOther() && col.Type != proto.ColumnType_JSON && !mixedTypeFilterable(ctx, mixed, col.Type) {
+		// The values were coerced to the type of the column, maybe into NULL (see coerceToColumnType), so MongoDB
+		// would compare them differently than Postgres does. Leave the qual for Postgres to apply
+		return nil, false
+	}
+
+	if !slices.Contains(pushableOperators[col.Type], qual.Operator) {
+		// Shouldn't happen, since the key columns only declare the pushable operators, but never send an incomplete filter
+		plugin.Logger(ctx).Warn("qualsToMongoFilter", "msg", "unsupported operator", "operator", qual.Operator, "column", colName)
+		return nil, false
+	}
+
+	// IS NULL has no value to convert. Missing fields are also NULL on Steampipe, and {$eq: null} matches them too
+	switch qual.Operator {
+	case quals.QualOperatorIsNull:
+		return bson.D{{Key: qual.Column, Value: bson.M{"$eq": nil}}}, true
+	case quals.QualOperatorIsNotNull:
+		return bson.D{{Key: qual.Column, Value: bson.M{"$ne": nil}}}, true
+	}
+
+	if isJSONBExistsOperator(qual.Operator) && !isSliceType(mongoType) {
+		// On objects, ? checks for keys, which can't be done with a Mongo filter. On arrays it checks for elements
+		return nil, false
+	}
+
+	// Lists come from conditions such as WHERE x IN ('a', 'b'), which arrive as x = ANY(['a', 'b']), or
+	// WHERE x NOT IN ('a', 'b'), which arrive as x <> ALL(['a', 'b'])
+	if list := qual.Value.GetListValue(); list != nil {
+		filterValues := make([]any, 0, len(list.Values))
+		for _, v := range list.Values {
+			if isJSONBExistsOperator(qual.Operator) {
+				element, ok := arrayElementToMongo(v.GetStringValue(), mongoType)
+				if !ok {
+					return nil, false
+				}
+				filterValues = append(filterValues, element)
 				continue
 			}
-			if asPrimitive, ok := mongoType.(analyzer.PrimitiveType); ok && asPrimitive == analyzer.PrimitiveObjectId {
-				// We know that this qual involves an originally-ObjectID column, which is presented as STRING to Steampipe
-				// Wrap the string qual with an ObjectID object
-				oid, err := primitive.ObjectIDFromHex(filterValue.(string)) // ObjectIDs are strings, so this cast (should?) be OK
-				if err != nil {
-					// Couldn't convert the incoming string value to an ObjectID, it may not be a valid 12-byte hex string
-					plugin.Logger(ctx).Error(err.Error())
-					continue // skip this qual
+			filterValue, err := qualValueToMongo(v, col.Type, mongoType)
+			if err != nil {
+				// Couldn't convert one of the values (e.g. an invalid ObjectID), so skip the entire qual
+				plugin.Logger(ctx).Error(err.Error())
+				return nil, false
+			}
+			if alternatives, ok := filterValue.(binaryAlternatives); ok {
+				for _, alternative := range alternatives {
+					filterValues = append(filterValues, alternative)
 				}
-				filterValue = oid // Overwrite filterValue with the ObjectID-ified version of the original string
+				continue
 			}
+			filterValues = append(filterValues, filterValue)
+		}
+		if len(filterValues) > 0 && isTimestamp(filterValues[0]) {
+			// $in would only match ordinal 0 of each second (see timestampFilter), so leave these to Steampipe
+			return nil, false
+		}
+
+		var filterOp bson.M
+		switch qual.Operator {
+		case quals.QualOperatorEqual:
+			filterOp = bson.M{"$in": filterValues}
+		case quals.QualOperatorNotEqual:
+			filterOp = bson.M{"$nin": filterValues}
+		case quals.QualOperatorJsonbExistsAny: // '["a", "b", "c"]'::jsonb ?| array['b', 'd'] → t
+			filterOp = bson.M{"$in": filterValues} // {$in: ['b', 'd']}
+		case quals.QualOperatorJsonbExistsAll: // '["a", "b", "c"]'::jsonb ?& array['a', 'b'] → t
+			filterOp = bson.M{"$all": filterValues} // {$all: ['a', 'b']}
+		default:
+			// e.g. x > ANY(...), which has no direct equivalent in Mongo. Postgres will apply it anyway
+			plugin.Logger(ctx).Warn("qualsToMongoFilter", "msg", "unsupported operator for list value", "operator", qual.Operator, "column", colName)
+			return nil, false
+		}
+		return bson.D{{Key: qual.Column, Value: filterOp}}, true
+	}
 
-			// Not implemented, because they don't have a clean mapping to Mongo operations:
-			// Combinations of (not) (i)like (x4)
-			// quals.QualOperatorJsonbContainsLeftRight,
-			// quals.QualOperatorJsonbContainsRightLeft,
-			// quals.QualOperatorJsonbPathExists,
-			// quals.QualOperatorJsonbPathPredicate,
-			var filterOp bson.M
+	if qual.Operator == quals.QualOperatorJsonbExistsOne { // '["a", "b"]'::jsonb ? 'b' → t
+		element, ok := arrayElementToMongo(qual.Value.GetStringValue(), mongoType)
+		if !ok {
+			return nil, false
+		}
+		return bson.D{{Key: qual.Column, Value: bson.M{"$eq": element}}}, true // {$eq: 'b'}
+	}
+
+	filterValue, err := qualValueToMongo(qual.Value, col.Type, mongoType)
+	if err != nil {
+		// Couldn't convert the incoming value, e.g. it may not be a valid 12-byte hex string for an ObjectID
+		plugin.Logger(ctx).Error(err.Error())
+		return nil, false // skip this qual
+	}
+
+	if isTimestamp(filterValue) {
+		filterOp, ok := timestampFilter(qual.Operator, qual.Value.GetTimestampValue().AsTime())
+		if !ok {
+			return nil, false
+		}
+		return bson.D{{Key: qual.Column, Value: filterOp}}, true
+	}
+	if alternatives, ok := filterValue.(binaryAlternatives); ok {
+		// Binary fields are compared by length and subtype before their bytes, so only (in)equality is pushed down
+		switch qual.Operator {
+		case quals.QualOperatorEqual:
+			return bson.D{{Key: qual.Column, Value: bson.M{"$in": alternatives}}}, true
+		case quals.QualOperatorNotEqual:
+			return bson.D{{Key: qual.Column, Value: bson.M{"$nin": alternatives}}}, true
+		default:
+			return nil, false
+		}
+	}
+	if isPatternOperator(qual.Operator) {
+		if _, ok := filterValue.(string); !ok {
+			// e.g. WHERE _id LIKE '5ca4%', MongoDB can't match patterns against ObjectIDs, UUIDs and so on
+			plugin.Logger(ctx).Warn("qualsToMongoFilter", "msg", "can't match a pattern against a non-string field", "column", colName)
+			return nil, false
+		}
+	}
+
+	if qual.Operator == quals.QualOperatorJsonbContainsLeftRight && col.Type == proto.ColumnType_JSON {
+		// Containment may expand to several conditions on subfields, so they're returned directly
+		containment, exact, err := jsonbContainmentFilter(colName, filterValue.(string), mongoType)
+		if err != nil {
+			plugin.Logger(ctx).Error(err.Error())
+			return nil, false
+		}
+		return containment, exact
+	}
+
+	// Not implemented (and thus not declared on pushableOperators), because they don't have a clean mapping to
+	// Mongo operations: quals.QualOperatorJsonbContainsRightLeft, quals.QualOperatorJsonbPathExists and
+	// quals.QualOperatorJsonbPathPredicate
+	var filterOp bson.M
+	switch qual.Operator {
+	case quals.QualOperatorEqual:
+		filterOp = bson.M{"$eq": filterValue}
+	case quals.QualOperatorNotEqual:
+		filterOp = bson.M{"$ne": filterValue}
+	case quals.QualOperatorGreater:
+		filterOp = bson.M{"$gt": filterValue}
+	case quals.QualOperatorLess:
+		filterOp = bson.M{"$lt": filterValue}
+	case quals.QualOperatorGreaterOrEqual:
+		filterOp = bson.M{"$gte": filterValue}
+	case quals.QualOperatorLessOrEqual:
+		filterOp = bson.M{"$lte": filterValue}
+	case quals.QualOperatorRegex:
+		filterOp = bson.M{"$regex": filterValue}
+	case quals.QualOperatorNotRegex:
+		filterOp = bson.M{"$not": bson.M{"$regex": filterValue}}
+	case quals.QualOperatorIRegex:
+		filterOp = bson.M{"$regex": filterValue, "$options": "i"}
+	case quals.QualOperatorNotIRegex:
+		filterOp = bson.M{"$not": bson.M{"$regex": filterValue, "$options": "i"}}
+	case quals.QualOperatorLike:
+		filterOp = likeToRegexFilter(filterValue.(string), false)
+	case quals.QualOperatorNotLike:
+		filterOp = bson.M{"$not": likeToRegexFilter(filterValue.(string), false)}
+	case quals.QualOperatorILike:
+		filterOp = likeToRegexFilter(filterValue.(string), true)
+	case quals.QualOperatorNotILike:
+		filterOp = bson.M{"$not": likeToRegexFilter(filterValue.(string), true)}
+	default:
+		// e.g. ?| with a single value, which isn't valid SQL anyway. Never return an empty filter for these
+		plugin.Logger(ctx).Warn("qualsToMongoFilter", "msg", "unsupported operator for scalar value", "operator", qual.Operator, "column", colName)
+		return nil, false
+	}
+
+	// For example, {"age": {"$gt": 1.2}}
+	return bson.D{{Key: qual.Column, Value: filterOp}}, true
+}
+
+/*
+qualValueToMongo converts a single (non-list) qual value into the Go value that must be sent to MongoDB. Steampipe sends
+the value according to the type of the column (colType), but MongoDB compares BSON types strictly, so the value must be
+converted to the type of the original field in MongoDB (mongoType), which may be one of several that are presented as
+the same Steampipe type. This is the inverse of [mongoTransformFunction]:
+  - ObjectID columns are presented as STRING, so WHERE _id='5ca4...' must become {_id: {$eq: ObjectID("5ca4...")}}
+  - UUIDs (Binary subtypes 3 and 4) are presented as STRING too, so they become [binaryAlternatives] with both subtypes.
+    MD5 hashes (Binary subtype 5) are presented as hex, and are decoded. Other Binary subtypes are presented as their
+    raw bytes, which are indistinguishable from the other two representations, so they return an error
+  - Symbols and JavaScript code are presented as STRING
+  - Int32 and Int64 are both INT
+  - Double and Decimal128 are both DOUBLE
+  - DateTime and Timestamp are both TIMESTAMP. Timestamps only keep the seconds, see [timestampFilter] for how they're
+    compared, and times before 1970 or after 2106 return an error, since they can't be stored on a Timestamp
+*/
+func qualValueToMongo(value *proto.QualValue, colType proto.ColumnType, mongoType analyzer.Type) (any, error) {
+	var filterValue any
+	switch colType {
+	case proto.ColumnType_STRING:
+		filterValue = value.GetStringValue()
+	case proto.ColumnType_JSON: // Supported JSONB operators (e.g. ExistsOne) still receive strings on RHS
+		filterValue = value.GetStringValue()
+	case proto.ColumnType_INT:
+		filterValue = value.GetInt64Value()
+	case proto.ColumnType_DOUBLE:
+		filterValue = value.GetDoubleValue()
+	case proto.ColumnType_BOOL:
+		filterValue = value.GetBoolValue()
+	case proto.ColumnType_TIMESTAMP:
+		filterValue = value.GetTimestampValue().AsTime()
+	}
+
+	if mixed, ok := mongoType.(analyzer.MixedType); ok {
+		mongoType = mixed.GetNonNilType() // Union[nil, T] is presented as T, so treat it as T
+	}
+	asPrimitive, ok := mongoType.(analyzer.PrimitiveType)
+	if !ok {
+		return filterValue, nil
+	}
+
+	switch v := filterValue.(type) {
+	case string:
+		switch asPrimitive {
+		case analyzer.PrimitiveObjectId:
+			return primitive.ObjectIDFromHex(v)
+		case analyzer.PrimitiveBinary:
+			return stringToBinary(v)
+		case analyzer.PrimitiveSymbol:
+			return primitive.Symbol(v), nil
+		case analyzer.PrimitiveJS:
+			return primitive.JavaScript(v), nil
+		}
+	case int64:
+		if asPrimitive == analyzer.PrimitiveInt32 && v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int32(v), nil
+		} // values that don't fit are sent as int64, MongoDB can still compare them against Int32 fields
+	case float64:
+		if asPrimitive == analyzer.PrimitiveDecimal {
+			return primitive.ParseDecimal128(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	case time.Time:
+		if asPrimitive == analyzer.PrimitiveTimestamp {
+			if v.Unix() < 0 || v.Unix() >= math.MaxUint32 {
+				return nil, fmt.Errorf("%s can't be compared against a BSON Timestamp", v)
+			}
+			return primitive.Timestamp{T: uint32(v.Unix())}, nil
+		}
+	}
+	return filterValue, nil
+}
+
+// binaryAlternatives are the Binary values that a single string may stand for, since some subtypes are presented in the
+// same way, see [qualValueToMongo]. A field is equal to the string if it's equal to any of them
+type binaryAlternatives []primitive.Binary
+
+// stringToBinary is the inverse of the conversion of Binary fields in [mongoTransformFunction]
+func stringToBinary(v string) (binaryAlternatives, error) {
+	if uu, err := uuid.Parse(v); err == nil && len(v) == 36 { // UUIDs are always presented with dashes
+		return binaryAlternatives{
+			{Subtype: bson.TypeBinaryUUID, Data: uu[:]},
+			{Subtype: bson.TypeBinaryUUIDOld, Data: uu[:]},
+		}, nil
+	}
+	if data, err := hex.DecodeString(v); err == nil && len(data) == md5.Size {
+		return binaryAlternatives{{Subtype: bson.TypeBinaryMD5, Data: data}}, nil
+	}
+	return nil, fmt.Errorf("%q isn't a UUID or an MD5 hash, so the subtype of the Binary field it stands for is unknown", v)
+}
+
+/*
+qualsUseIndex reports whether at least one of the quals can be served by an index on one of the indexed fields. Negations
+(e.g. <>, NOT LIKE or IS NOT NULL) and patterns that aren't anchored at the start can't, since MongoDB would still
+have to check every key of the index
+*/
+func qualsUseIndex(inputQuals plugin.KeyColumnQualMap, indexed []string) bool {
+	for _, field := range indexed {
+		filteredColumn, ok := inputQuals[field]
+		if !ok {
+			continue
+		}
+		for _, qual := range filteredColumn.Quals {
 			switch qual.Operator {
-			case quals.QualOperatorEqual:
-				filterOp = bson.M{"$eq": filterValue}
-			case quals.QualOperatorNotEqual:
-				filterOp = bson.M{"$ne": filterValue}
-			case quals.QualOperatorGreater:
-				filterOp = bson.M{"$gt": filterValue}
-			case quals.QualOperatorLess:
-				filterOp = bson.M{"$lt": filterValue}
-			case quals.QualOperatorGreaterOrEqual:
-				filterOp = bson.M{"$gte": filterValue}
-			case quals.QualOperatorLessOrEqual:
-				filterOp = bson.M{"$lte": filterValue}
-			case quals.QualOperatorIsNull:
-				filterOp = bson.M{"$eq": nil}
-			case quals.QualOperatorIsNotNull:
-				filterOp = bson.M{"$ne": nil}
+			case quals.QualOperatorEqual, quals.QualOperatorLess, quals.QualOperatorLessOrEqual, quals.QualOperatorGreater,
+				quals.QualOperatorGreaterOrEqual, quals.QualOperatorIsNull, quals.QualOperatorJsonbContainsLeftRight,
+				quals.QualOperatorJsonbExistsOne, quals.QualOperatorJsonbExistsAny, quals.QualOperatorJsonbExistsAll:
+				return true
+			case quals.QualOperatorLike:
+				regex, _ := likeToRegexFilter(qual.Value.GetStringValue(), false)["$regex"].(string)
+				if strings.HasPrefix(regex, "^") {
+					return true
+				}
 			case quals.QualOperatorRegex:
-				filterOp = bson.M{"$regex": filterValue}
-			case quals.QualOperatorNotRegex:
-				filterOp = bson.M{"$not": bson.M{"$regex": filterValue}}
-			case quals.QualOperatorIRegex:
-				filterOp = bson.M{"$regex": filterValue, "$options": "i"}
-			case quals.QualOperatorNotIRegex:
-				filterOp = bson.M{"$not": bson.M{"$regex": filterValue, "$options": "i"}}
-			case quals.QualOperatorJsonbExistsOne: // '["a", "b"]'::jsonb ? 'b' → t
-				filterOp = bson.M{"$eq": filterValue} // {$eq: 'b'}
-			case quals.QualOperatorJsonbExistsAny: // '["a", "b", "c"]'::jsonb ?| array['b', 'd'] → t
-				filterOp = bson.M{"$in": filterValue} // {$in: ['b', 'd']}
-			case quals.QualOperatorJsonbExistsAll: // '["a", "b", "c"]'::jsonb ?& array['a', 'b'] → t
-				filterOp = bson.M{"$all": filterValue} // {$all: ['a', 'b']}
+				if strings.HasPrefix(qual.Value.GetStringValue(), "^") {
+					return true
+				}
 			}
+		}
+	}
+	return false
+}
+
+func isJSONBExistsOperator(operator string) bool {
+	return operator == quals.QualOperatorJsonbExistsOne || operator == quals.QualOperatorJsonbExistsAny || operator == quals.QualOperatorJsonbExistsAll
+}
+
+/*
+arrayElementToMongo converts a string that the ?, ?| or ?& operators look for among the elements of an array of type
+mongoType into the value that MongoDB should compare against those elements, like [jsonScalarToMongo] does for
+containment. It returns false if the elements aren't all JSON-native: e.g. ObjectIDs and dates are presented as strings
+inside JSONB columns, so Postgres would find them, but MongoDB would never match them against a string
+*/
+func arrayElementToMongo(value string, mongoType analyzer.Type) (any, bool) {
+	if mixed, ok := mongoType.(analyzer.MixedType); ok {
+		mongoType = mixed.GetNonNilType()
+	}
+	asSlice, ok := mongoType.(analyzer.SliceType)
+	if !ok {
+		return nil, false
+	}
+	return jsonScalarToMongo(value, asSlice.Type)
+}
+
+func isSliceType(t analyzer.Type) bool {
+	if mixed, ok := t.(analyzer.MixedType); ok {
+		t = mixed.GetNonNilType()
+	}
+	_, ok := t.(analyzer.SliceType)
+	return ok
+}
 
-			// For example, {"age": {"$gt": 1.2}}
-			filter = append(filter, bson.E{Key: qual.Column, Value: filterOp})
+func isTimestamp(v any) bool {
+	_, ok := v.(primitive.Timestamp)
+	return ok
+}
+
+// isPatternOperator reports whether operator matches a string against a pattern (i.e. regexes and LIKEs)
+func isPatternOperator(operator string) bool {
+	switch operator {
+	case quals.QualOperatorRegex, quals.QualOperatorNotRegex, quals.QualOperatorIRegex, quals.QualOperatorNotIRegex,
+		quals.QualOperatorLike, quals.QualOperatorNotLike, quals.QualOperatorILike, quals.QualOperatorNotILike:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+timestampFilter builds the filter for a comparison of a BSON Timestamp field against t. Timestamps are (seconds, ordinal)
+pairs, and are presented to Steampipe as just the seconds, so each comparison must consider all ordinals of that second
+(e.g. WHERE ts='2024-01-01T00:00:00Z' must match Timestamp(1704067200, 5) too). If t has a fractional second, no
+Timestamp can be equal to it, so < and >= compare against the next second instead. t is expected to be within the range
+of Timestamps (see [qualValueToMongo]). The second return value is false for operators that can't be pushed down:
+those that aren't comparisons, and = and <> on fractional seconds (which match no documents and all of them)
+*/
+func timestampFilter(operator string, t time.Time) (bson.M, bool) {
+	firstOfSecond := primitive.Timestamp{T: uint32(t.Unix())}
+	lastOfSecond := primitive.Timestamp{T: uint32(t.Unix()), I: math.MaxUint32}
+	fractional := t.Nanosecond() != 0
+	firstOfNext := firstOfSecond // the first Timestamp that is >= t
+	if fractional {
+		firstOfNext = primitive.Timestamp{T: uint32(t.Unix()) + 1}
+	}
+
+	switch operator {
+	case quals.QualOperatorEqual:
+		return bson.M{"$gte": firstOfSecond, "$lte": lastOfSecond}, !fractional
+	case quals.QualOperatorNotEqual:
+		return bson.M{"$not": bson.M{"$gte": firstOfSecond, "$lte": lastOfSecond}}, !fractional
+	case quals.QualOperatorGreater:
+		return bson.M{"$gt": lastOfSecond}, true
+	case quals.QualOperatorGreaterOrEqual:
+		return bson.M{"$gte": firstOfNext}, true
+	case quals.QualOperatorLess:
+		return bson.M{"$lt": firstOfNext}, true
+	case quals.QualOperatorLessOrEqual:
+		return bson.M{"$lte": lastOfSecond}, true
+	default:
+		return nil, false
+	}
+}
+
+/*
+likeToRegexFilter converts a Postgres LIKE pattern into an equivalent MongoDB $regex filter. Regex metacharacters in the
+pattern are escaped, % becomes .* and _ becomes ., and a backslash makes the next character literal (which is the
+default escape character for LIKE). The regex is anchored on both sides, since LIKE must match the entire string.
+
+Leading and trailing .* are dropped (along with their anchor), since they're redundant. This matters for patterns such as
+'abc%', which become ^abc: MongoDB can only use an index to serve a case-sensitive regex when it's a plain prefix
+expression, see https://www.mongodb.com/docs/manual/reference/operator/query/regex/#index-use
+*/
+func likeToRegexFilter(pattern string, caseInsensitive bool) bson.M {
+	var parts []string // each part is an escaped literal, ".*" or "."
+	var literal strings.Builder
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			parts = append(parts, regexp.QuoteMeta(literal.String()))
+			literal.Reset()
 		}
 	}
-	return filter
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				literal.WriteRune(runes[i])
+			} else {
+				literal.WriteRune(r) // a trailing backslash is just a backslash
+			}
+		case '%':
+			flushLiteral()
+			if len(parts) == 0 || parts[len(parts)-1] != ".*" { // %% is the same as %
+				parts = append(parts, ".*")
+			}
+		case '_':
+			flushLiteral()
+			parts = append(parts, ".")
+		default:
+			literal.WriteRune(r)
+		}
+	}
+	flushLiteral()
+
+	anchorStart, anchorEnd := true, true
+	if len(parts) > 0 && parts[0] == ".*" {
+		parts, anchorStart = parts[1:], false
+		anchorEnd = len(parts) > 0 // the pattern was just %, which matches everything
+	}
+	if len(parts) > 0 && parts[len(parts)-1] == ".*" {
+		parts, anchorEnd = parts[:len(parts)-1], false
+	}
+
+	regex := strings.Join(parts, "")
+	if anchorStart {
+		regex = "^" + regex
+	}
+	if anchorEnd {
+		regex += "$"
+	}
+
+	options := ""
+	if caseInsensitive {
+		options += "i"
+	}
+	if slices.Contains(parts, ".") || slices.Contains(parts, ".*") {
+		options += "s" // in LIKE, wildcards also match newlines
+	}
+
+	if options == "" {
+		return bson.M{"$regex": regex}
+	}
+	return bson.M{"$regex": regex, "$options": options}
+}
+
+/*
+jsonbContainmentFilter translates a JSONB containment condition (WHERE col @> 'value') into MongoDB conditions:
+  - Objects become one equality per (nested) key, using dotted paths: '{"a": {"b": 1}}' => {"col.a.b": 1}
+  - Arrays become $all, and objects inside arrays become $elemMatch: '["x", {"a": 1}]' => {"col": {"$all": ["x", {"$elemMatch": {"a": 1}}]}}
+  - Scalars become equality, which also matches arrays that contain the scalar: '"x"' => {"col": "x"}
+
+The returned conditions may match more documents than the containment would (Postgres rechecks all conditions on the
+rows that are returned anyway), but never fewer. For that reason, parts of the value are skipped (i.e. not pushed down)
+whenever their type in mongoType isn't one where the JSON value can be directly compared against the stored value.
+For example, ObjectIDs and dates are presented as strings inside JSONB columns, but comparing the stored ObjectID against
+that string in MongoDB would never match. The second return value is false if the conditions may match more documents,
+either because some part was skipped or because MongoDB compares it more loosely (see [containmentConditions])
+*/
+func jsonbContainmentFilter(colName, value string, mongoType analyzer.Type) (bson.D, bool, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber() // keep large integers exact, instead of turning them into float64
+	var parsed any
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, false, fmt.Errorf("couldn't parse JSONB value %q for column %s: %w", value, colName, err)
+	}
+	conditions, exact := containmentConditions(colName, parsed, mongoType, false)
+	return conditions, exact, nil
+}
+
+/*
+containmentConditions returns the conditions that check that the field at path contains value, see
+[jsonbContainmentFilter]. nested is false for the column itself, and true for the fields inside it. The second return
+value is false if the conditions may match more documents than the containment, which happens when:
+  - a part of the value is skipped, e.g. nested arrays, keys that can't be dotted paths or values of unknown types
+  - the value is an empty object or array, which produces no condition but only matches objects or arrays in Postgres
+  - the value is null, since {field: null} also matches documents where the field is missing
+  - a scalar is compared against a nested field that may be an array: MongoDB matches any of its elements, but Postgres
+    only allows a scalar to be contained in an array at the top level
+*/
+func containmentConditions(path string, value any, mongoType analyzer.Type, nested bool) (bson.D, bool) {
+	if mixed, ok := mongoType.(analyzer.MixedType); ok {
+		mongoType = mixed.GetNonNilType()
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		asStruct, ok := mongoType.(analyzer.StructType)
+		if !ok {
+			return nil, false
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys) // for a stable filter
+
+		conditions := bson.D{}
+		exact := len(keys) > 0
+		for _, k := range keys {
+			childType, known := asStruct[k]
+			if !known || k == "" || strings.Contains(k, ".") || strings.HasPrefix(k, "$") {
+				exact = false
+				continue // these keys can't be expressed as a dotted path, or we don't know their type
+			}
+			childConditions, childExact := containmentConditions(joinPath(path, k), v[k], childType, true)
+			conditions = append(conditions, childConditions...)
+			exact = exact && childExact
+		}
+		return conditions, exact
+	case []any:
+		asSlice, ok := mongoType.(analyzer.SliceType)
+		if !ok {
+			return nil, false
+		}
+		elemType := asSlice.Type
+		if mixed, ok := elemType.(analyzer.MixedType); ok {
+			elemType = mixed.GetNonNilType()
+		}
+
+		elements := bson.A{}
+		exact := true
+		for _, elem := range v {
+			switch e := elem.(type) {
+			case map[string]any:
+				// Each object must be contained in (at least) one element, which is checked relative to that element
+				inner, innerExact := containmentConditions("", e, elemType, true)
+				if len(inner) > 0 {
+					elements = append(elements, bson.M{"$elemMatch": inner})
+				}
+				exact = exact && innerExact && len(inner) > 0
+			case []any:
+				exact = false
+				continue // nested arrays aren't pushed down
+			default:
+				scalar, ok := jsonScalarToMongo(e, elemType)
+				if ok {
+					elements = append(elements, scalar)
+				}
+				exact = exact && ok && e != nil
+			}
+		}
+		if len(elements) == 0 {
+			return nil, false
+		}
+		return bson.D{{Key: path, Value: bson.M{"$all": elements}}}, exact
+	default:
+		exact := v != nil && !(nested && mayBeSlice(mongoType))
+		if asSlice, ok := mongoType.(analyzer.SliceType); ok {
+			mongoType = asSlice.Type // equality against an array matches if any of its elements is equal
+		}
+		if scalar, ok := jsonScalarToMongo(v, mongoType); ok && path != "" {
+			return bson.D{{Key: path, Value: scalar}}, exact
+		}
+		return nil, false
+	}
+}
+
+// mayBeSlice reports whether a field of type t may hold an array, either because it always does or because one of its
+// types is an array
+func mayBeSlice(t analyzer.Type) bool {
+	if mixed, ok := t.(analyzer.MixedType); ok {
+		return slices.ContainsFunc(mixed, isSliceType)
+	}
+	return isSliceType(t)
+}
+
+func joinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
+
+/*
+jsonScalarToMongo converts a scalar JSON value into the Go value that MongoDB should compare against a field of type
+mongoType, and returns false if that comparison wouldn't give the same answer as the JSON comparison would.
+Only JSON-native types qualify (strings, booleans, numbers and nulls). Decimal128 doesn't, because MongoDB compares
+it exactly against doubles (so 1.1 doesn't equal NumberDecimal("1.1")). Mixed types qualify only if all of their
+members are JSON-native or structures, since e.g. a string could never match a field that is sometimes an ObjectID
+*/
+func jsonScalarToMongo(value any, mongoType analyzer.Type) (any, bool) {
+	if mixed, ok := mongoType.(analyzer.MixedType); ok {
+		for _, member := range mixed {
+			switch member.(type) {
+			case analyzer.StructType, analyzer.SliceType:
+				continue
+			}
+			if member != analyzer.NilType && !isJSONNativePrimitive(member) {
+				return nil, false
+			}
+		}
+	} else if mongoType != analyzer.NilType && !isJSONNativePrimitive(mongoType) {
+		return nil, false
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		if asInt, err := v.Int64(); err == nil {
+			return asInt, true
+		}
+		asFloat, err := v.Float64()
+		return asFloat, err == nil
+	case string, bool, nil:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+func isJSONNativePrimitive(t analyzer.Type) bool {
+	switch t {
+	case analyzer.PrimitiveString, analyzer.PrimitiveBool, analyzer.PrimitiveDouble, analyzer.PrimitiveInt32, analyzer.PrimitiveInt64:
+		return true
+	default:
+		return false
+	}
 }
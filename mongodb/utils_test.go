@@ -2,15 +2,23 @@ package mongodb
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/google/uuid"
 	"github.com/hashicorp/go-hclog"
 	"github.com/jreyesr/steampipe-plugin-mongodb/mongodb/analyzer"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/context_key"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"math"
 	"reflect"
+	"slices"
 	"testing"
 	"time"
 )
@@ -30,18 +38,20 @@ var typeMap = analyzer.StructType{
 	"field": analyzer.StructType{
 		"string": analyzer.PrimitiveString,
 		"ts":     analyzer.PrimitiveTimestamp,
+		"date":   analyzer.PrimitiveDateTime,
 	},
 }
 var columns = []*plugin.Column{
 	{Name: "_id", Type: proto.ColumnType_STRING},
 	{Name: "field.string", Type: proto.ColumnType_STRING},
 	{Name: "field.ts", Type: proto.ColumnType_TIMESTAMP},
+	{Name: "field.date", Type: proto.ColumnType_TIMESTAMP},
 }
 
 func TestStringQual(t *testing.T) {
 	qual := makeQual("field.string", "=", "val")
 
-	filter := qualsToMongoFilter(ctx(), qual, columns, typeMap)
+	filter, _ := qualsToMongoFilter(ctx(), qual, columns, typeMap)
 	expected := bson.D{{"field.string", bson.M{"$eq": "val"}}}
 
 	if !reflect.DeepEqual(filter, expected) {
@@ -52,8 +62,8 @@ func TestStringQual(t *testing.T) {
 func TestTimestampQual(t *testing.T) {
 	qual := makeQual("field.ts", "<=", time.Unix(0, 0))
 
-	filter := qualsToMongoFilter(ctx(), qual, columns, typeMap)
-	expected := bson.D{{"field.ts", bson.M{"$lte": time.Unix(0, 0).UTC()}}}
+	filter, _ := qualsToMongoFilter(ctx(), qual, columns, typeMap)
+	expected := bson.D{{"field.ts", bson.M{"$lte": primitive.Timestamp{T: 0, I: math.MaxUint32}}}}
 
 	if !reflect.DeepEqual(filter, expected) {
 		t.Errorf("Expected filter to be %v but it was %v", expected, filter)
@@ -63,7 +73,7 @@ func TestTimestampQual(t *testing.T) {
 func TestRegexQual(t *testing.T) {
 	qual := makeQual("field.string", "!~*", ".*")
 
-	filter := qualsToMongoFilter(ctx(), qual, columns, typeMap)
+	filter, _ := qualsToMongoFilter(ctx(), qual, columns, typeMap)
 	expected := bson.D{{"field.string", bson.M{"$not": bson.M{"$regex": ".*", "$options": "i"}}}}
 
 	if !reflect.DeepEqual(filter, expected) {
@@ -75,10 +85,824 @@ func TestObjectIDQual(t *testing.T) {
 	oid := primitive.NewObjectID()
 	qual := makeQual("_id", "=", oid.Hex())
 
-	filter := qualsToMongoFilter(ctx(), qual, columns, typeMap)
+	filter, _ := qualsToMongoFilter(ctx(), qual, columns, typeMap)
 	expected := bson.D{{"_id", bson.M{"$eq": oid}}}
 
 	if !reflect.DeepEqual(filter, expected) {
 		t.Errorf("Expected filter to be %v but it was %v", expected, filter)
 	}
 }
+
+func makeListQual(column, op string, vals ...any) plugin.KeyColumnQualMap {
+	values := make([]*proto.QualValue, 0, len(vals))
+	for _, v := range vals {
+		if ts, ok := v.(time.Time); ok {
+			// proto.NewQualValue doesn't know about time.Time, and would turn it into a string
+			values = append(values, &proto.QualValue{Value: &proto.QualValue_TimestampValue{TimestampValue: timestamppb.New(ts)}})
+			continue
+		}
+		values = append(values, proto.NewQualValue(v))
+	}
+	listValue := &proto.QualValue{Value: &proto.QualValue_ListValue{ListValue: &proto.QualValueList{Values: values}}}
+	return plugin.KeyColumnQualMap{
+		column: {Name: column, Quals: []*quals.Qual{{Column: column, Operator: op, Value: listValue}}},
+	}
+}
+
+func TestListQuals(t *testing.T) {
+	oid1, oid2 := primitive.NewObjectID(), primitive.NewObjectID()
+
+	cases := []struct {
+		name     string
+		qual     plugin.KeyColumnQualMap
+		expected bson.D
+	}{
+		{
+			name:     "in",
+			qual:     makeListQual("field.string", "=", "a", "b"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$in": []any{"a", "b"}}}},
+		},
+		{
+			name:     "not in",
+			qual:     makeListQual("field.string", "<>", "a", "b"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$nin": []any{"a", "b"}}}},
+		},
+		{
+			name:     "single element",
+			qual:     makeListQual("field.string", "=", "a"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$in": []any{"a"}}}},
+		},
+		{
+			name:     "dates",
+			qual:     makeListQual("field.date", "=", time.Unix(0, 0), time.Unix(60, 0)),
+			expected: bson.D{{Key: "field.date", Value: bson.M{"$in": []any{time.Unix(0, 0).UTC(), time.Unix(60, 0).UTC()}}}},
+		},
+		{
+			name:     "bson timestamps are left to steampipe",
+			qual:     makeListQual("field.ts", "=", time.Unix(0, 0), time.Unix(60, 0)),
+			expected: bson.D{},
+		},
+		{
+			name:     "object ids",
+			qual:     makeListQual("_id", "=", oid1.Hex(), oid2.Hex()),
+			expected: bson.D{{Key: "_id", Value: bson.M{"$in": []any{oid1, oid2}}}},
+		},
+		{
+			name:     "object ids not in",
+			qual:     makeListQual("_id", "<>", oid1.Hex()),
+			expected: bson.D{{Key: "_id", Value: bson.M{"$nin": []any{oid1}}}},
+		},
+		{
+			name:     "invalid object id drops the qual",
+			qual:     makeListQual("_id", "=", oid1.Hex(), "not-an-oid"),
+			expected: bson.D{},
+		},
+		{
+			name:     "unsupported operator drops the qual",
+			qual:     makeListQual("field.string", ">", "a", "b"),
+			expected: bson.D{},
+		},
+		{
+			name:     "scalar still uses $eq",
+			qual:     makeQual("field.string", "=", "a"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$eq": "a"}}},
+		},
+		{
+			name:     "scalar still uses $ne",
+			qual:     makeQual("_id", "<>", oid1.Hex()),
+			expected: bson.D{{Key: "_id", Value: bson.M{"$ne": oid1}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, _ := qualsToMongoFilter(ctx(), tc.qual, columns, typeMap)
+			if !reflect.DeepEqual(filter, tc.expected) {
+				t.Errorf("Expected filter to be %v but it was %v", tc.expected, filter)
+			}
+		})
+	}
+}
+
+func TestLikeQuals(t *testing.T) {
+	cases := []struct {
+		name     string
+		qual     plugin.KeyColumnQualMap
+		expected bson.D
+	}{
+		{
+			name:     "prefix",
+			qual:     makeQual("field.string", "~~", "Steam%"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": "^Steam"}}},
+		},
+		{
+			name:     "suffix",
+			qual:     makeQual("field.string", "~~", "%pipe"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": "pipe$"}}},
+		},
+		{
+			name:     "exact",
+			qual:     makeQual("field.string", "~~", "steampipe"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": "^steampipe$"}}},
+		},
+		{
+			name:     "wildcards in the middle",
+			qual:     makeQual("field.string", "~~", "a%b_c"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": "^a.*b.c$", "$options": "s"}}},
+		},
+		{
+			name:     "metacharacters are escaped",
+			qual:     makeQual("field.string", "~~", "1.5+(x)%"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": `^1\.5\+\(x\)`}}},
+		},
+		{
+			name:     "escaped wildcards are literal",
+			qual:     makeQual("field.string", "~~", `100\%\_%`),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": "^100%_"}}},
+		},
+		{
+			name:     "match everything",
+			qual:     makeQual("field.string", "~~", "%%"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": ""}}},
+		},
+		{
+			name:     "not like",
+			qual:     makeQual("field.string", "!~~", "a%"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$not": bson.M{"$regex": "^a"}}}},
+		},
+		{
+			name:     "ilike",
+			qual:     makeQual("field.string", "~~*", "%Pipe%"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$regex": "Pipe", "$options": "i"}}},
+		},
+		{
+			name:     "not ilike",
+			qual:     makeQual("field.string", "!~~*", "a_"),
+			expected: bson.D{{Key: "field.string", Value: bson.M{"$not": bson.M{"$regex": "^a.$", "$options": "is"}}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, _ := qualsToMongoFilter(ctx(), tc.qual, columns, typeMap)
+			if !reflect.DeepEqual(filter, tc.expected) {
+				t.Errorf("Expected filter to be %v but it was %v", tc.expected, filter)
+			}
+		})
+	}
+}
+
+func TestJsonbContainmentQuals(t *testing.T) {
+	jsonTypeMap := analyzer.StructType{
+		"tags": analyzer.SliceType{Type: analyzer.PrimitiveString},
+		"address": analyzer.StructType{
+			"country": analyzer.PrimitiveString,
+			"zip":     analyzer.PrimitiveInt32,
+			"geo":     analyzer.StructType{"lat": analyzer.PrimitiveDouble},
+			"ref":     analyzer.PrimitiveObjectId,
+			"lines":   analyzer.SliceType{Type: analyzer.PrimitiveString},
+		},
+		"items": analyzer.SliceType{Type: analyzer.StructType{
+			"sku": analyzer.PrimitiveString,
+			"qty": analyzer.PrimitiveInt64,
+		}},
+		"mixed": analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveObjectId},
+	}
+	jsonColumns := []*plugin.Column{
+		{Name: "tags", Type: proto.ColumnType_JSON},
+		{Name: "address", Type: proto.ColumnType_JSON},
+		{Name: "items", Type: proto.ColumnType_JSON},
+		{Name: "mixed", Type: proto.ColumnType_JSON},
+	}
+
+	cases := []struct {
+		name     string
+		qual     plugin.KeyColumnQualMap
+		expected bson.D
+		complete bool
+	}{
+		{
+			name:     "array of scalars",
+			qual:     makeQual("tags", "@>", `["prod", "eu"]`),
+			expected: bson.D{{Key: "tags", Value: bson.M{"$all": bson.A{"prod", "eu"}}}},
+			complete: true,
+		},
+		{
+			name:     "scalar in array",
+			qual:     makeQual("tags", "@>", `"prod"`),
+			expected: bson.D{{Key: "tags", Value: "prod"}},
+			complete: true,
+		},
+		{
+			name:     "object",
+			qual:     makeQual("address", "@>", `{"country": "EC", "zip": 170150}`),
+			expected: bson.D{{Key: "address.country", Value: "EC"}, {Key: "address.zip", Value: int64(170150)}},
+			complete: true,
+		},
+		{
+			name:     "nested object",
+			qual:     makeQual("address", "@>", `{"geo": {"lat": -0.5}}`),
+			expected: bson.D{{Key: "address.geo.lat", Value: -0.5}},
+			complete: true,
+		},
+		{
+			name:     "object ids are skipped",
+			qual:     makeQual("address", "@>", `{"country": "EC", "ref": "5ca4bbc7a2dd94ee5816238d"}`),
+			expected: bson.D{{Key: "address.country", Value: "EC"}},
+		},
+		{
+			name:     "unknown keys are skipped",
+			qual:     makeQual("address", "@>", `{"street": "Main"}`),
+			expected: bson.D{},
+		},
+		{
+			name: "array of objects",
+			qual: makeQual("items", "@>", `[{"sku": "x", "qty": 2}]`),
+			expected: bson.D{{Key: "items", Value: bson.M{"$all": bson.A{
+				bson.M{"$elemMatch": bson.D{{Key: "qty", Value: int64(2)}, {Key: "sku", Value: "x"}}},
+			}}}},
+			complete: true,
+		},
+		{
+			name:     "mixed with object ids is skipped",
+			qual:     makeQual("mixed", "@>", `"abc"`),
+			expected: bson.D{},
+		},
+		{
+			name:     "wrong shape is skipped",
+			qual:     makeQual("tags", "@>", `{"a": 1}`),
+			expected: bson.D{},
+		},
+		{
+			name:     "nested arrays are skipped",
+			qual:     makeQual("items", "@>", `[["x"], {"sku": "x"}]`),
+			expected: bson.D{{Key: "items", Value: bson.M{"$all": bson.A{bson.M{"$elemMatch": bson.D{{Key: "sku", Value: "x"}}}}}}},
+		},
+		{
+			name:     "null also matches missing fields",
+			qual:     makeQual("address", "@>", `{"country": null}`),
+			expected: bson.D{{Key: "address.country", Value: nil}},
+		},
+		{
+			name:     "scalar in a nested array",
+			qual:     makeQual("address", "@>", `{"lines": "Main"}`),
+			expected: bson.D{{Key: "address.lines", Value: "Main"}},
+		},
+		{
+			name:     "empty object",
+			qual:     makeQual("address", "@>", `{}`),
+			expected: bson.D{},
+		},
+		{
+			name:     "invalid json is skipped",
+			qual:     makeQual("tags", "@>", `["prod"`),
+			expected: bson.D{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, complete := qualsToMongoFilter(ctx(), tc.qual, jsonColumns, jsonTypeMap)
+			if !reflect.DeepEqual(filter, tc.expected) {
+				t.Errorf("Expected filter to be %v but it was %v", tc.expected, filter)
+			}
+			if complete != tc.complete {
+				// Partial translations would break a LIMIT that is pushed down along with them
+				t.Errorf("Expected complete to be %v but it was %v", tc.complete, complete)
+			}
+		})
+	}
+}
+
+func TestQualValueToMongo(t *testing.T) {
+	oid := primitive.NewObjectID()
+	uu := uuid.New()
+	ts := time.Unix(1704067200, 0)
+	dec, _ := primitive.ParseDecimal128("1.1")
+
+	cases := []struct {
+		name      string
+		value     *proto.QualValue
+		colType   proto.ColumnType
+		mongoType analyzer.Type
+		expected  any
+	}{
+		{"string", proto.NewQualValue("abc"), proto.ColumnType_STRING, analyzer.PrimitiveString, "abc"},
+		{"object id", proto.NewQualValue(oid.Hex()), proto.ColumnType_STRING, analyzer.PrimitiveObjectId, oid},
+		{"uuid", proto.NewQualValue(uu.String()), proto.ColumnType_STRING, analyzer.PrimitiveBinary, binaryAlternatives{{Subtype: bson.TypeBinaryUUID, Data: uu[:]}, {Subtype: bson.TypeBinaryUUIDOld, Data: uu[:]}}},
+		{"symbol", proto.NewQualValue("sym"), proto.ColumnType_STRING, analyzer.PrimitiveSymbol, primitive.Symbol("sym")},
+		{"javascript", proto.NewQualValue("f()"), proto.ColumnType_STRING, analyzer.PrimitiveJS, primitive.JavaScript("f()")},
+		{"int32", proto.NewQualValue(int64(42)), proto.ColumnType_INT, analyzer.PrimitiveInt32, int32(42)},
+		{"int32 out of range", proto.NewQualValue(int64(math.MaxInt32 + 1)), proto.ColumnType_INT, analyzer.PrimitiveInt32, int64(math.MaxInt32 + 1)},
+		{"int64", proto.NewQualValue(int64(42)), proto.ColumnType_INT, analyzer.PrimitiveInt64, int64(42)},
+		{"double", proto.NewQualValue(1.1), proto.ColumnType_DOUBLE, analyzer.PrimitiveDouble, 1.1},
+		{"decimal", proto.NewQualValue(1.1), proto.ColumnType_DOUBLE, analyzer.PrimitiveDecimal, dec},
+		{"bool", proto.NewQualValue(true), proto.ColumnType_BOOL, analyzer.PrimitiveBool, true},
+		{"date", &proto.QualValue{Value: &proto.QualValue_TimestampValue{TimestampValue: timestamppb.New(ts)}}, proto.ColumnType_TIMESTAMP, analyzer.PrimitiveDateTime, ts.UTC()},
+		{"timestamp", &proto.QualValue{Value: &proto.QualValue_TimestampValue{TimestampValue: timestamppb.New(ts)}}, proto.ColumnType_TIMESTAMP, analyzer.PrimitiveTimestamp, primitive.Timestamp{T: 1704067200}},
+		{"nullable int32", proto.NewQualValue(int64(7)), proto.ColumnType_INT, analyzer.MixedType{analyzer.NilType, analyzer.PrimitiveInt32}, int32(7)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			converted, err := qualValueToMongo(tc.value, tc.colType, tc.mongoType)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(converted, tc.expected) {
+				t.Errorf("Expected value to be %#v but it was %#v", tc.expected, converted)
+			}
+		})
+	}
+}
+
+func TestQualValueToMongoInvalidObjectID(t *testing.T) {
+	if _, err := qualValueToMongo(proto.NewQualValue("nope"), proto.ColumnType_STRING, analyzer.PrimitiveObjectId); err == nil {
+		t.Errorf("Expected an error for an invalid ObjectID")
+	}
+}
+
+func TestTimestampFilter(t *testing.T) {
+	ts := primitive.Timestamp{T: 100}
+	last := primitive.Timestamp{T: 100, I: math.MaxUint32}
+
+	cases := map[string]bson.M{
+		"=":  {"$gte": ts, "$lte": last},
+		"<>": {"$not": bson.M{"$gte": ts, "$lte": last}},
+		">":  {"$gt": last},
+		">=": {"$gte": ts},
+		"<":  {"$lt": ts},
+		"<=": {"$lte": last},
+	}
+	for op, expected := range cases {
+		filter, ok := timestampFilter(op, time.Unix(100, 0))
+		if !ok || !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected filter for %s to be %v but it was %v", op, expected, filter)
+		}
+	}
+	if _, ok := timestampFilter("~~", time.Unix(100, 0)); ok {
+		t.Errorf("Expected LIKE to be rejected")
+	}
+}
+
+func TestTimestampFilterFractionalSecond(t *testing.T) {
+	// Timestamps only have whole seconds, so e.g. second 100 is < 100.5, and the first one that is >= 100.5 is 101
+	last := primitive.Timestamp{T: 100, I: math.MaxUint32}
+	next := primitive.Timestamp{T: 101}
+
+	cases := map[string]bson.M{
+		">":  {"$gt": last},
+		">=": {"$gte": next},
+		"<":  {"$lt": next},
+		"<=": {"$lte": last},
+	}
+	for op, expected := range cases {
+		filter, ok := timestampFilter(op, time.Unix(100, 500_000_000))
+		if !ok || !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected filter for %s to be %v but it was %v", op, expected, filter)
+		}
+	}
+	for _, op := range []string{"=", "<>"} {
+		if filter, ok := timestampFilter(op, time.Unix(100, 500_000_000)); ok {
+			t.Errorf("Expected %s on a fractional second not to be pushed down, but it was %v", op, filter)
+		}
+	}
+}
+
+func TestTimestampQualsOnFractionalSeconds(t *testing.T) {
+	at := time.Unix(1704067200, 250_000_000)
+	cases := map[string]bson.D{
+		"<":  {{Key: "field.ts", Value: bson.M{"$lt": primitive.Timestamp{T: 1704067201}}}},
+		">=": {{Key: "field.ts", Value: bson.M{"$gte": primitive.Timestamp{T: 1704067201}}}},
+		"=":  {},
+		"<>": {},
+	}
+	for op, expected := range cases {
+		qual := makeListQual("field.ts", op, at)
+		qual["field.ts"].Quals[0].Value = qual["field.ts"].Quals[0].Value.GetListValue().Values[0] // a single value
+		filter, _ := qualsToMongoFilter(ctx(), qual, columns, typeMap)
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected filter for %s to be %v but it was %v", op, expected, filter)
+		}
+	}
+}
+
+func TestTimestampQualsOutOfRange(t *testing.T) {
+	for _, at := range []time.Time{time.Unix(-1, 0), time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), time.Unix(math.MaxUint32+1, 0)} {
+		value := &proto.QualValue{Value: &proto.QualValue_TimestampValue{TimestampValue: timestamppb.New(at)}}
+		if converted, err := qualValueToMongo(value, proto.ColumnType_TIMESTAMP, analyzer.PrimitiveTimestamp); err == nil {
+			t.Errorf("Expected an error for %s, but got %v", at, converted)
+		}
+	}
+	// The qual is left for Postgres to apply, instead of wrapping around to a Timestamp after 1970
+	qual := makeListQual("field.ts", "<", time.Unix(-10, 0))
+	qual["field.ts"].Quals[0].Value = qual["field.ts"].Quals[0].Value.GetListValue().Values[0]
+	if filter, _ := qualsToMongoFilter(ctx(), qual, columns, typeMap); len(filter) != 0 {
+		t.Errorf("Expected no filter but it was %v", filter)
+	}
+}
+
+func TestBinaryQuals(t *testing.T) {
+	binaryTypeMap := analyzer.StructType{"bin": analyzer.PrimitiveBinary}
+	binaryColumns := []*plugin.Column{{Name: "bin", Type: proto.ColumnType_STRING}}
+	uu := uuid.New()
+	uuid4 := primitive.Binary{Subtype: bson.TypeBinaryUUID, Data: uu[:]}
+	uuid3 := primitive.Binary{Subtype: bson.TypeBinaryUUIDOld, Data: uu[:]}
+	hash := md5.Sum([]byte("steampipe"))
+	md5Binary := primitive.Binary{Subtype: bson.TypeBinaryMD5, Data: hash[:]}
+
+	cases := []struct {
+		name     string
+		quals    plugin.KeyColumnQualMap
+		expected bson.D
+	}{
+		{"uuid", makeQual("bin", "=", uu.String()), bson.D{{Key: "bin", Value: bson.M{"$in": binaryAlternatives{uuid4, uuid3}}}}},
+		{"not uuid", makeQual("bin", "<>", uu.String()), bson.D{{Key: "bin", Value: bson.M{"$nin": binaryAlternatives{uuid4, uuid3}}}}},
+		{"md5", makeQual("bin", "=", hex.EncodeToString(hash[:])), bson.D{{Key: "bin", Value: bson.M{"$in": binaryAlternatives{md5Binary}}}}},
+		{"in", makeListQual("bin", "=", uu.String(), hex.EncodeToString(hash[:])), bson.D{{Key: "bin", Value: bson.M{"$in": []any{uuid4, uuid3, md5Binary}}}}},
+		{"other subtypes", makeQual("bin", "=", "raw bytes"), bson.D{}},
+		{"in with other subtypes", makeListQual("bin", "=", uu.String(), "raw bytes"), bson.D{}},
+		{"comparison", makeQual("bin", ">", uu.String()), bson.D{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, _ := qualsToMongoFilter(ctx(), tc.quals, binaryColumns, binaryTypeMap)
+			if !reflect.DeepEqual(filter, tc.expected) {
+				t.Errorf("Expected filter to be %v but it was %v", tc.expected, filter)
+			}
+		})
+	}
+}
+
+// TestBinaryQualsAreTheInverseOfTheTransform checks that every Binary subtype that can be pushed down round-trips
+func TestBinaryQualsAreTheInverseOfTheTransform(t *testing.T) {
+	uu := uuid.New()
+	hash := md5.Sum([]byte("steampipe"))
+	for _, original := range []primitive.Binary{
+		{Subtype: bson.TypeBinaryUUID, Data: uu[:]},
+		{Subtype: bson.TypeBinaryUUIDOld, Data: uu[:]},
+		{Subtype: bson.TypeBinaryMD5, Data: hash[:]},
+	} {
+		presented, err := mongoTransformFunction(ctx(), &transform.TransformData{Value: original})
+		if err != nil {
+			t.Fatal(err)
+		}
+		converted, err := qualValueToMongo(proto.NewQualValue(presented), proto.ColumnType_STRING, analyzer.PrimitiveBinary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.ContainsFunc(converted.(binaryAlternatives), func(b primitive.Binary) bool { return reflect.DeepEqual(b, original) }) {
+			t.Errorf("Expected %v to be converted back to %v, but got %v", presented, original, converted)
+		}
+	}
+
+	for _, subtype := range []byte{bson.TypeBinaryGeneric, bson.TypeBinaryFunction, bson.TypeBinaryUserDefined} {
+		original := primitive.Binary{Subtype: subtype, Data: []byte("raw bytes")}
+		presented, err := mongoTransformFunction(ctx(), &transform.TransformData{Value: original})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if converted, err := qualValueToMongo(proto.NewQualValue(presented), proto.ColumnType_STRING, analyzer.PrimitiveBinary); err == nil {
+			t.Errorf("Expected an error for subtype %d, since it can't be told apart from the others, but got %v", subtype, converted)
+		}
+	}
+}
+
+func TestPatternOnNonStringFieldIsSkipped(t *testing.T) {
+	binaryTypeMap := analyzer.StructType{"uuid": analyzer.PrimitiveBinary}
+	binaryColumns := []*plugin.Column{{Name: "uuid", Type: proto.ColumnType_STRING}}
+
+	filter, _ := qualsToMongoFilter(ctx(), makeQual("uuid", "~~", "abc%"), binaryColumns, binaryTypeMap)
+	if len(filter) != 0 {
+		t.Errorf("Expected no filter but it was %v", filter)
+	}
+}
+
+func TestOnlyPushableOperatorsProduceFilters(t *testing.T) {
+	allTypeMap := analyzer.StructType{
+		"str":   analyzer.PrimitiveString,
+		"int":   analyzer.PrimitiveInt64,
+		"dbl":   analyzer.PrimitiveDouble,
+		"bool":  analyzer.PrimitiveBool,
+		"date":  analyzer.PrimitiveDateTime,
+		"tags":  analyzer.SliceType{Type: analyzer.PrimitiveString},
+		"inner": analyzer.StructType{"a": analyzer.PrimitiveString},
+	}
+	allColumns := []*plugin.Column{
+		{Name: "str", Type: proto.ColumnType_STRING},
+		{Name: "int", Type: proto.ColumnType_INT},
+		{Name: "dbl", Type: proto.ColumnType_DOUBLE},
+		{Name: "bool", Type: proto.ColumnType_BOOL},
+		{Name: "date", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "tags", Type: proto.ColumnType_JSON},
+		{Name: "inner", Type: proto.ColumnType_JSON},
+	}
+	values := map[proto.ColumnType]any{
+		proto.ColumnType_STRING:    "a%",
+		proto.ColumnType_INT:       int64(1),
+		proto.ColumnType_DOUBLE:    1.5,
+		proto.ColumnType_BOOL:      true,
+		proto.ColumnType_TIMESTAMP: "2024-01-01T00:00:00Z",
+		proto.ColumnType_JSON:      `["a"]`,
+	}
+
+	for _, col := range allColumns {
+		for _, op := range plugin.GetValidOperators() {
+			for _, asList := range []bool{false, true} {
+				qual := makeQual(col.Name, op, values[col.Type])
+				if asList {
+					qual = makeListQual(col.Name, op, values[col.Type])
+				}
+
+				filter, _ := qualsToMongoFilter(ctx(), qual, allColumns, allTypeMap)
+				for _, e := range filter {
+					if m, isMap := e.Value.(bson.M); e.Value == nil || (isMap && m == nil) {
+						t.Errorf("Operator %s on %s (list=%v) produced an empty filter entry %v", op, col.Name, asList, filter)
+					}
+				}
+				if !slices.Contains(pushableOperators[col.Type], op) && len(filter) > 0 {
+					t.Errorf("Operator %s isn't pushable on %s, but it produced filter %v", op, col.Name, filter)
+				}
+			}
+		}
+	}
+}
+
+func TestQualsForColumnOfTypeDeclaresPushableOperators(t *testing.T) {
+	for colType, expected := range pushableOperators {
+		keyColumn := qualsForColumnOfType("col", colType)
+		if !reflect.DeepEqual(keyColumn.Operators, expected) {
+			t.Errorf("Expected operators for %s to be %v but they were %v", colType, expected, keyColumn.Operators)
+		}
+		for _, op := range keyColumn.Operators {
+			if !slices.Contains(plugin.GetValidOperators(), op) {
+				t.Errorf("Operator %s for %s isn't valid for the SDK", op, colType)
+			}
+		}
+	}
+	if keyColumn := qualsForColumnOfType("col", proto.ColumnType_UNKNOWN); len(keyColumn.Operators) != 0 {
+		t.Errorf("Expected no operators for unknown columns but they were %v", keyColumn.Operators)
+	}
+}
+
+func TestJsonbExistsOnlyOnArrays(t *testing.T) {
+	objTypeMap := analyzer.StructType{"inner": analyzer.StructType{"a": analyzer.PrimitiveString}, "tags": analyzer.SliceType{Type: analyzer.PrimitiveString}}
+	objColumns := []*plugin.Column{{Name: "inner", Type: proto.ColumnType_JSON}, {Name: "tags", Type: proto.ColumnType_JSON}}
+
+	if filter, _ := qualsToMongoFilter(ctx(), makeQual("inner", "?", "a"), objColumns, objTypeMap); len(filter) != 0 {
+		t.Errorf("Expected no filter for ? on an object but it was %v", filter)
+	}
+	filter, _ := qualsToMongoFilter(ctx(), makeQual("tags", "?", "a"), objColumns, objTypeMap)
+	expected := bson.D{{Key: "tags", Value: bson.M{"$eq": "a"}}}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("Expected filter to be %v but it was %v", expected, filter)
+	}
+}
+
+func TestJsonbExistsByElementType(t *testing.T) {
+	arrayTypeMap := analyzer.StructType{
+		"tags":  analyzer.SliceType{Type: analyzer.PrimitiveString},
+		"refs":  analyzer.SliceType{Type: analyzer.PrimitiveObjectId},
+		"dates": analyzer.SliceType{Type: analyzer.PrimitiveDateTime},
+		"mixed": analyzer.SliceType{Type: analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveInt32}},
+	}
+	arrayColumns := []*plugin.Column{
+		{Name: "tags", Type: proto.ColumnType_JSON},
+		{Name: "refs", Type: proto.ColumnType_JSON},
+		{Name: "dates", Type: proto.ColumnType_JSON},
+		{Name: "mixed", Type: proto.ColumnType_JSON},
+	}
+	oid := "5ca4bbc7a2dd94ee5816238d"
+
+	cases := []struct {
+		name     string
+		qual     plugin.KeyColumnQualMap
+		expected bson.D
+	}{
+		{"? on strings", makeQual("tags", "?", "a"), bson.D{{Key: "tags", Value: bson.M{"$eq": "a"}}}},
+		{"?| on strings", makeListQual("tags", "?|", "a", "b"), bson.D{{Key: "tags", Value: bson.M{"$in": []any{"a", "b"}}}}},
+		{"?& on strings", makeListQual("tags", "?&", "a", "b"), bson.D{{Key: "tags", Value: bson.M{"$all": []any{"a", "b"}}}}},
+		{"? on mixed native types", makeQual("mixed", "?", "a"), bson.D{{Key: "mixed", Value: bson.M{"$eq": "a"}}}},
+		{"? on ObjectIDs", makeQual("refs", "?", oid), nil},
+		{"?| on ObjectIDs", makeListQual("refs", "?|", oid), nil},
+		{"?& on dates", makeListQual("dates", "?&", "2024-01-01T00:00:00Z"), nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, complete := qualsToMongoFilter(ctx(), tc.qual, arrayColumns, arrayTypeMap)
+			if tc.expected == nil {
+				// Postgres finds these among the strings that the elements are presented as, but MongoDB wouldn't
+				if len(filter) != 0 || complete {
+					t.Errorf("Expected the qual to be left to Postgres, but the filter was %v (complete=%v)", filter, complete)
+				}
+				return
+			}
+			if !reflect.DeepEqual(filter, tc.expected) || !complete {
+				t.Errorf("Expected filter to be %v but it was %v (complete=%v)", tc.expected, filter, complete)
+			}
+		})
+	}
+}
+
+func TestNullQualsOnObjectID(t *testing.T) {
+	filter, _ := qualsToMongoFilter(ctx(), makeQual("_id", "is null", nil), columns, typeMap)
+	expected := bson.D{{Key: "_id", Value: bson.M{"$eq": nil}}}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("Expected filter to be %v but it was %v", expected, filter)
+	}
+}
+
+func TestSkippedQualDisablesLimit(t *testing.T) {
+	skipTypeMap := analyzer.StructType{
+		"str":    analyzer.PrimitiveString,
+		"ts":     analyzer.PrimitiveTimestamp,
+		"bin":    analyzer.PrimitiveBinary,
+		"_id":    analyzer.PrimitiveObjectId,
+		"inner":  analyzer.StructType{"a": analyzer.PrimitiveString},
+		"mixed":  analyzer.MixedType{analyzer.PrimitiveString, analyzer.PrimitiveInt32},
+		"number": analyzer.PrimitiveInt64,
+	}
+	skipColumns := []*plugin.Column{
+		{Name: "str", Type: proto.ColumnType_STRING},
+		{Name: "ts", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "bin", Type: proto.ColumnType_STRING},
+		{Name: "_id", Type: proto.ColumnType_STRING},
+		{Name: "inner", Type: proto.ColumnType_JSON},
+		{Name: "mixed", Type: proto.ColumnType_STRING},
+		{Name: "number", Type: proto.ColumnType_INT},
+	}
+	fractional := makeListQual("ts", "=", time.Unix(1704067200, 250_000_000))
+	fractional["ts"].Quals[0].Value = fractional["ts"].Quals[0].Value.GetListValue().Values[0]
+
+	cases := []struct {
+		name     string
+		quals    plugin.KeyColumnQualMap
+		complete bool
+	}{
+		{"translated", makeQual("str", "=", "a"), true},
+		{"no quals", plugin.KeyColumnQualMap{}, true},
+		{"? on an object", makeQual("inner", "?", "a"), false},
+		{"mixed types", makeQual("mixed", "=", "a"), false},
+		{"timestamps in a list", makeListQual("ts", "=", time.Unix(1704067200, 0)), false},
+		{"timestamp with fractional seconds", fractional, false},
+		{"comparison on binaries", makeQual("bin", ">", uuid.NewString()), false},
+		{"pattern on an ObjectID", makeQual("_id", "~~", "5ca4%"), false},
+		{"invalid ObjectID", makeQual("_id", "=", "not an id"), false},
+		{"invalid containment", makeQual("inner", "@>", `{"a": `), false},
+		{"unknown column", makeQual("missing", "=", "a"), false},
+	}
+	limit := int64(10)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A translated qual doesn't make up for one that was skipped
+			tc.quals["number"] = makeQual("number", "=", int64(1))["number"]
+
+			_, complete := qualsToMongoFilter(ctx(), tc.quals, skipColumns, skipTypeMap)
+			if complete != tc.complete {
+				t.Fatalf("Expected complete to be %v but it was %v", tc.complete, complete)
+			}
+			pushed := pushedLimit(&limit, complete)
+			if tc.complete && (pushed == nil || *pushed != limit) {
+				t.Errorf("Expected the limit to be pushed down, but it was %v", pushed)
+			}
+			if !tc.complete && pushed != nil {
+				t.Errorf("Expected no limit, since a qual was skipped, but it was %d", *pushed)
+			}
+		})
+	}
+	if pushed := pushedLimit(nil, true); pushed != nil {
+		t.Errorf("Expected no limit for queries without one, but it was %d", *pushed)
+	}
+}
+
+func TestQualsUseIndex(t *testing.T) {
+	indexed := []string{"_id", "email"}
+
+	cases := []struct {
+		name     string
+		qual     plugin.KeyColumnQualMap
+		expected bool
+	}{
+		{"equality", makeQual("email", "=", "a@b.c"), true},
+		{"in", makeListQual("email", "=", "a@b.c", "d@e.f"), true},
+		{"range", makeQual("_id", ">", "5ca4bbc7a2dd94ee5816238d"), true},
+		{"prefix like", makeQual("email", "~~", "john%"), true},
+		{"suffix like", makeQual("email", "~~", "%@example.com"), false},
+		{"anchored regex", makeQual("email", "~", "^john"), true},
+		{"unanchored regex", makeQual("email", "~", "john"), false},
+		{"negation", makeQual("email", "<>", "a@b.c"), false},
+		{"is not null", makeQual("email", "is not null", nil), false},
+		{"unindexed field", makeQual("bio", "=", "hello"), false},
+		{"no quals", plugin.KeyColumnQualMap{}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := qualsUseIndex(tc.qual, indexed); got != tc.expected {
+				t.Errorf("Expected qualsUseIndex to be %v but it was %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestBSONToJSON(t *testing.T) {
+	oid := primitive.NewObjectID()
+	converted, err := bsonToJSON(bson.D{{Key: "_id", Value: oid}, {Key: "n", Value: int32(1)}, {Key: "tags", Value: bson.A{"a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"_id": map[string]any{"$oid": oid.Hex()}, "n": float64(1), "tags": []any{"a"}}
+
+	if !reflect.DeepEqual(converted, expected) {
+		t.Errorf("Expected %v but got %v", expected, converted)
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	pipeline, err := parsePipeline(`[{"$match": {"_id": {"$oid": "5ca4bbc7a2dd94ee5816238d"}}}, {"$limit": 1}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oid, _ := primitive.ObjectIDFromHex("5ca4bbc7a2dd94ee5816238d")
+	expected := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "_id", Value: oid}}}},
+		{{Key: "$limit", Value: int32(1)}},
+	}
+
+	if !reflect.DeepEqual(pipeline, expected) {
+		t.Errorf("Expected pipeline to be %v but it was %v", expected, pipeline)
+	}
+}
+
+func TestParsePipelineRejectsObject(t *testing.T) {
+	if _, err := parsePipeline(`{"$match": {}}`); err == nil {
+		t.Errorf("Expected an error when the pipeline isn't an array")
+	}
+}
+
+func TestParsePipelineRejectsWriteStages(t *testing.T) {
+	for _, raw := range []string{
+		`[{"$match": {}}, {"$out": "copy"}]`,
+		`[{"$merge": {"into": "copy"}}]`,
+	} {
+		if _, err := parsePipeline(raw); err == nil {
+			t.Errorf("Expected an error for %s", raw)
+		}
+	}
+}
+
+func TestSamplingStage(t *testing.T) {
+	cases := []struct {
+		Name           string
+		CollectionType string
+		Pipeline       mongo.Pipeline
+		SampleSize     int
+		Expected       bson.D
+	}{
+		{"collection", collectionTypeCollection, nil, 100, bson.D{{Key: "$sample", Value: bson.M{"size": 100}}}},
+		{"time series", collectionTypeTimeSeries, nil, 100, bson.D{{Key: "$sample", Value: bson.M{"size": 100}}}},
+		{"view", collectionTypeView, nil, 100, bson.D{{Key: "$limit", Value: 100}}},
+		{"configured view", collectionTypeCollection, mongo.Pipeline{{{Key: "$match", Value: bson.M{}}}}, 100, bson.D{{Key: "$limit", Value: 100}}},
+		{"no sampling", collectionTypeCollection, nil, 0, nil},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			stage := samplingStage(tc.CollectionType, tc.Pipeline, tc.SampleSize)
+			if !reflect.DeepEqual(stage, tc.Expected) {
+				t.Errorf("Expected %v but got %v", tc.Expected, stage)
+			}
+		})
+	}
+}
+
+func TestColumnsToProjection(t *testing.T) {
+	tableColumns := []*plugin.Column{
+		{Name: "_id"}, {Name: "name"}, {Name: "name.first"}, {Name: "name.last"}, {Name: "names"}, {Name: "age"},
+		{Name: "a"}, {Name: "a-b"}, {Name: "a.c"},
+	}
+	cases := []struct {
+		Name      string
+		Requested []string
+		Expected  bson.D
+	}{
+		{"simple", []string{"age", "_id"}, bson.D{{Key: "_id", Value: 1}, {Key: "age", Value: 1}}},
+		{"excludes _id", []string{"age"}, bson.D{{Key: "age", Value: 1}, {Key: "_id", Value: 0}}},
+		{"nested", []string{"name.first", "name.last"}, bson.D{{Key: "name.first", Value: 1}, {Key: "name.last", Value: 1}, {Key: "_id", Value: 0}}},
+		{"parent wins over child", []string{"name.first", "name"}, bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 0}}},
+		{"parent isn't right before child", []string{"a.c", "a-b", "a"}, bson.D{{Key: "a", Value: 1}, {Key: "a-b", Value: 1}, {Key: "_id", Value: 0}}},
+		{"similar prefix isn't a parent", []string{"name", "names"}, bson.D{{Key: "name", Value: 1}, {Key: "names", Value: 1}, {Key: "_id", Value: 0}}},
+		{"ignores unknown columns", []string{"age", "_ctx"}, bson.D{{Key: "age", Value: 1}, {Key: "_id", Value: 0}}},
+		{"no columns", []string{}, bson.D{{Key: "_id", Value: 1}}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			projection := columnsToProjection(tc.Requested, tableColumns)
+			if !reflect.DeepEqual(projection, tc.Expected) {
+				t.Errorf("Expected %v but got %v", tc.Expected, projection)
+			}
+		})
+	}
+}